@@ -0,0 +1,288 @@
+package telecraft
+
+import (
+	"context"
+	"iter"
+	"slices"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+)
+
+const DefaultBroadcastWorkers = 4
+
+type BroadcastStatus int
+
+const (
+	BroadcastSent BroadcastStatus = iota + 1
+	// BroadcastFailed covers send errors and errors of the builder.
+	BroadcastFailed
+	// BroadcastBlocked means the bot may not write to the chat anymore.
+	BroadcastBlocked
+	// BroadcastSkipped means the builder returned no chattable.
+	BroadcastSkipped
+	// BroadcastCancelled means the send was interrupted by Cancel or the
+	// context of the broadcast.
+	BroadcastCancelled
+)
+
+// BroadcastBuilder makes the chattable sent to chatID; a nil chattable skips
+// the chat.
+type BroadcastBuilder = func(chatID int64) (tgbotapi.Chattable, error)
+
+type BroadcastOptions struct {
+	// Workers is the number of sends in flight; the rate limits still apply.
+	Workers int
+	// OnResult is called for every recipient once it is done, e.g. to mark
+	// blocked users.
+	OnResult func(BroadcastResult)
+}
+
+type BroadcastResult struct {
+	ChatID  int64
+	Status  BroadcastStatus
+	Message tgbotapi.Message
+	Err     error
+}
+
+type BroadcastProgress struct {
+	Sent      int
+	Failed    int
+	Blocked   int
+	Skipped   int
+	Cancelled int
+}
+
+func (p BroadcastProgress) Total() int {
+	return p.Sent + p.Failed + p.Blocked + p.Skipped + p.Cancelled
+}
+
+// Broadcast is a running broadcast. Pausing stops taking recipients, the sends
+// in flight still finish.
+type Broadcast struct {
+	mutex    sync.Mutex
+	results  []BroadcastResult
+	progress BroadcastProgress
+	resumed  chan struct{}
+	err      error
+	ctx      context.Context
+	cancel   func()
+	done     chan struct{}
+}
+
+// Broadcast sends what builder makes to every chat of recipients in the
+// background, through the same rate limiter and retries as the replies. It
+// stops when ctx is done or Cancel is called.
+func (t *TeleCraft) Broadcast(
+	ctx context.Context,
+	recipients iter.Seq[int64],
+	builder BroadcastBuilder,
+	broadcastOptions *BroadcastOptions,
+) *Broadcast {
+	if broadcastOptions == nil {
+		broadcastOptions = &BroadcastOptions{}
+	}
+	workers := broadcastOptions.Workers
+	if workers <= 0 {
+		workers = DefaultBroadcastWorkers
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	b := &Broadcast{
+		resumed: make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	close(b.resumed)
+
+	chatIDs := make(chan int64)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for chatID := range chatIDs {
+				b.record(t.broadcastTo(ctx, chatID, builder), broadcastOptions.OnResult)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(b.done)
+		defer cancel()
+
+		err := b.feed(recipients, chatIDs)
+		close(chatIDs)
+		wg.Wait()
+
+		b.mutex.Lock()
+		b.err = err
+		b.mutex.Unlock()
+	}()
+
+	return b
+}
+
+func (b *Broadcast) feed(recipients iter.Seq[int64], chatIDs chan<- int64) error {
+	scope := "telecraft.broadcast.feed"
+
+	for chatID := range recipients {
+		if !b.waitResumed() {
+			return telecrafterror.Wrap(b.ctx.Err()).Scope(scope).Input(chatID).Errorf("the broadcast has been cancelled")
+		}
+		select {
+		case chatIDs <- chatID:
+		case <-b.ctx.Done():
+			return telecrafterror.Wrap(b.ctx.Err()).Scope(scope).Input(chatID).Errorf("the broadcast has been cancelled")
+		}
+	}
+	return nil
+}
+
+func (t *TeleCraft) broadcastTo(ctx context.Context, chatID int64, builder BroadcastBuilder) BroadcastResult {
+	scope := "telecraft.broadcast"
+
+	result := BroadcastResult{ChatID: chatID}
+
+	chattable, err := builder(chatID)
+	switch {
+	case err != nil:
+		result.Status = BroadcastFailed
+		result.Err = telecrafterror.Wrap(err).Scope(scope).Input(chatID).Errorf("error to build the message")
+		return result
+	case chattable == nil:
+		result.Status = BroadcastSkipped
+		return result
+	}
+
+	result.Message, result.Err = t.requestContext(ctx, chattable)
+	switch {
+	case result.Err == nil:
+		result.Status = BroadcastSent
+	case IsBlocked(result.Err):
+		result.Status = BroadcastBlocked
+	case ctx.Err() != nil:
+		result.Status = BroadcastCancelled
+	default:
+		result.Status = BroadcastFailed
+	}
+	return result
+}
+
+func (b *Broadcast) record(result BroadcastResult, onResult func(BroadcastResult)) {
+	b.mutex.Lock()
+	b.results = append(b.results, result)
+	switch result.Status {
+	case BroadcastSent:
+		b.progress.Sent++
+	case BroadcastFailed:
+		b.progress.Failed++
+	case BroadcastBlocked:
+		b.progress.Blocked++
+	case BroadcastSkipped:
+		b.progress.Skipped++
+	case BroadcastCancelled:
+		b.progress.Cancelled++
+	}
+	b.mutex.Unlock()
+
+	if onResult != nil {
+		onResult(result)
+	}
+}
+
+// waitResumed blocks while the broadcast is paused and reports whether it
+// should go on.
+func (b *Broadcast) waitResumed() bool {
+	b.mutex.Lock()
+	resumed := b.resumed
+	b.mutex.Unlock()
+
+	select {
+	case <-resumed:
+		return b.ctx.Err() == nil
+	case <-b.ctx.Done():
+		return false
+	}
+}
+
+func (b *Broadcast) Pause() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	select {
+	case <-b.resumed:
+		b.resumed = make(chan struct{})
+	default:
+	}
+}
+
+func (b *Broadcast) Resume() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	select {
+	case <-b.resumed:
+	default:
+		close(b.resumed)
+	}
+}
+
+func (b *Broadcast) IsPaused() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	select {
+	case <-b.resumed:
+		return false
+	default:
+		return true
+	}
+}
+
+// Cancel stops the broadcast; sends in flight give up their waits.
+func (b *Broadcast) Cancel() {
+	b.cancel()
+}
+
+// Done is closed once the broadcast has finished or was cancelled.
+func (b *Broadcast) Done() <-chan struct{} {
+	return b.done
+}
+
+// Wait blocks until the broadcast is done and returns its final progress, with
+// an error when it was cancelled before every recipient was taken.
+func (b *Broadcast) Wait() (BroadcastProgress, error) {
+	<-b.done
+	return b.Progress(), b.Err()
+}
+
+// Err is the error of a cancelled broadcast, nil while it runs or when it went
+// through every recipient.
+func (b *Broadcast) Err() error {
+	select {
+	case <-b.done:
+	default:
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.err
+}
+
+func (b *Broadcast) Progress() BroadcastProgress {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.progress
+}
+
+// Results returns the result of every recipient done so far, in the order
+// they finished.
+func (b *Broadcast) Results() []BroadcastResult {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return slices.Clone(b.results)
+}
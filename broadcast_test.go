@@ -0,0 +1,104 @@
+package telecraft
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/ratelimit"
+	"github.com/mohamadrezamomeni/telecraft/telecrafttest"
+)
+
+func announce(chatID int64) (tgbotapi.Chattable, error) {
+	switch chatID {
+	case 4:
+		return nil, errors.New("the user has no language")
+	case 5:
+		return nil, nil
+	}
+	return tgbotapi.NewMessage(chatID, "news"), nil
+}
+
+func TestBroadcast(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBot(t, server)
+	bot.telecraftOptions.MaxSendAttempts = 1
+	server.Fail("sendMessage", http.StatusInternalServerError, "Internal Server Error", 0)
+	server.Fail("sendMessage", http.StatusForbidden, "Forbidden: bot was blocked by the user", 0)
+
+	results := []BroadcastResult{}
+	b := bot.Broadcast(context.Background(), slices.Values([]int64{1, 2, 3, 4, 5}), announce, &BroadcastOptions{
+		Workers:  1,
+		OnResult: func(result BroadcastResult) { results = append(results, result) },
+	})
+
+	progress, err := b.Wait()
+	if err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+
+	expected := BroadcastProgress{Sent: 1, Failed: 2, Blocked: 1, Skipped: 1}
+	if progress != expected {
+		t.Errorf("we expected progress %+v but we got %+v", expected, progress)
+	}
+
+	for i, status := range []BroadcastStatus{BroadcastFailed, BroadcastBlocked, BroadcastSent, BroadcastFailed, BroadcastSkipped} {
+		if results[i].ChatID != int64(i+1) || results[i].Status != status {
+			t.Errorf("we expected status %d for chat %d but we got %+v", status, i+1, results[i])
+		}
+	}
+	if len(b.Results()) != 5 {
+		t.Errorf("we expected 5 results but we got %d", len(b.Results()))
+	}
+}
+
+func TestBroadcastPauseAndCancel(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBot(t, server)
+	bot.limiter = ratelimit.New(ratelimit.Limits{Global: ratelimit.Every(1, 20*time.Millisecond)})
+
+	recipients := []int64{}
+	for chatID := int64(1); chatID <= 100; chatID++ {
+		recipients = append(recipients, chatID)
+	}
+
+	b := bot.Broadcast(context.Background(), slices.Values(recipients), announce, &BroadcastOptions{Workers: 1})
+
+	waitFor(t, func() bool { return b.Progress().Total() >= 2 })
+	b.Pause()
+	if !b.IsPaused() {
+		t.Error("we expected the broadcast be paused")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	paused := b.Progress().Total()
+	time.Sleep(100 * time.Millisecond)
+	if total := b.Progress().Total(); total != paused {
+		t.Errorf("we expected no progress while paused but it went from %d to %d", paused, total)
+	}
+
+	b.Resume()
+	waitFor(t, func() bool { return b.Progress().Total() > paused })
+
+	b.Cancel()
+	progress, err := b.Wait()
+	if err == nil {
+		t.Error("we expected an error for a cancelled broadcast")
+	}
+	if progress.Total() >= len(recipients) {
+		t.Errorf("we expected the broadcast be cut short but it reached %d", progress.Total())
+	}
+	for _, result := range b.Results() {
+		if result.Status == BroadcastFailed && errors.Is(result.Err, context.Canceled) {
+			t.Errorf("we expected the interrupted send to %d be cancelled but it failed", result.ChatID)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package telecraft
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// BotClient is the part of the Telegram Bot API the framework talks to.
+// *tgbotapi.BotAPI implements it; updates are fetched through Request with a
+// tgbotapi.UpdateConfig.
+type BotClient interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+	UploadFiles(endpoint string, params tgbotapi.Params, files []tgbotapi.RequestFile) (*tgbotapi.APIResponse, error)
+	GetFile(config tgbotapi.FileConfig) (tgbotapi.File, error)
+	GetFileDirectURL(fileID string) (string, error)
+}
+
+var _ BotClient = (*tgbotapi.BotAPI)(nil)
+
+func newBotClient(telecraftOptions *TeleCraftOptions) (BotClient, error) {
+	if telecraftOptions.Client != nil {
+		return telecraftOptions.Client, nil
+	}
+	return tgbotapi.NewBotAPIWithAPIEndpoint(telecraftOptions.Token, telecraftOptions.APIEndpoint)
+}
+
+// Client gives handlers access to the Bot API, e.g. to download files.
+func (t *TeleCraft) Client() BotClient {
+	return t.bot
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/env"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+	"github.com/mohamadrezamomeni/telecraft"
+	"github.com/mohamadrezamomeni/telecraft/dispatcher"
+	"github.com/mohamadrezamomeni/telecraft/pkg/log"
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+	"github.com/mohamadrezamomeni/telecraft/ratelimit"
+	"github.com/mohamadrezamomeni/telecraft/router"
+)
+
+const DefaultEnvPrefix = "TELECRAFT_"
+
+type Config struct {
+	Bot     BotConfig     `koanf:"bot"`
+	State   StateConfig   `koanf:"state"`
+	Webhook WebhookConfig `koanf:"webhook"`
+	Log     log.LogConfig `koanf:"log"`
+}
+
+type BotConfig struct {
+	Token         string `koanf:"token"`
+	APIEndpoint   string `koanf:"api_endpoint"`
+	DefaultRoute  string `koanf:"default_route"`
+	MaxGoroutines int    `koanf:"max_goroutines"`
+	Timeout       int    `koanf:"timeout"`
+	// QueueSize of -1 leaves the queue unbounded.
+	QueueSize int `koanf:"queue_size"`
+	// OverflowPolicy is one of "block", "drop_oldest" or "reject".
+	OverflowPolicy  string        `koanf:"overflow_policy"`
+	BusyMessage     string        `koanf:"busy_message"`
+	ErrorMessage    string        `koanf:"error_message"`
+	ShutdownTimeout time.Duration `koanf:"shutdown_timeout"`
+	MaxSendAttempts int           `koanf:"max_send_attempts"`
+	RetryBackoff    time.Duration `koanf:"retry_backoff"`
+	MaxRetryDelay   time.Duration `koanf:"max_retry_delay"`
+	// The rate limits look like "30/1s"; empty ones take the limits of
+	// Telegram and "0/1s" is unlimited.
+	GlobalRateLimit string `koanf:"global_rate_limit"`
+	ChatRateLimit   string `koanf:"chat_rate_limit"`
+	GroupRateLimit  string `koanf:"group_rate_limit"`
+	// OutboxPath turns the outbox on with a file at the path.
+	OutboxPath string `koanf:"outbox_path"`
+}
+
+type StateConfig struct {
+	Type string        `koanf:"type"`
+	TTL  time.Duration `koanf:"ttl"`
+	// KeyStrategy is one of "user", "chat", "user_in_chat" or "topic".
+	KeyStrategy string `koanf:"key_strategy"`
+}
+
+type WebhookConfig struct {
+	URL                string   `koanf:"url"`
+	ListenAddr         string   `koanf:"listen_addr"`
+	Path               string   `koanf:"path"`
+	SecretToken        string   `koanf:"secret_token"`
+	CertFile           string   `koanf:"cert_file"`
+	KeyFile            string   `koanf:"key_file"`
+	UploadCertificate  bool     `koanf:"upload_certificate"`
+	MaxConnections     int      `koanf:"max_connections"`
+	AllowedUpdates     []string `koanf:"allowed_updates"`
+	DropPendingUpdates bool     `koanf:"drop_pending_updates"`
+}
+
+var overflowPolicies = map[string]dispatcher.OverflowPolicy{
+	"block":       dispatcher.Block,
+	"drop_oldest": dispatcher.DropOldest,
+	"reject":      dispatcher.Reject,
+}
+
+var keyStrategies = map[string]router.KeyStrategy{
+	"user":         router.KeyByUser,
+	"chat":         router.KeyByChat,
+	"user_in_chat": router.KeyByUserInChat,
+	"topic":        router.KeyByTopic,
+}
+
+// Load reads the YAML or TOML file at path, chosen by its extension, and then
+// the environment variables starting with envPrefix, which override the file.
+// Nested keys are separated by a double underscore in variable names, so
+// TELECRAFT_BOT__DEFAULT_ROUTE sets bot.default_route. An empty path only
+// reads the environment.
+func Load(path string, envPrefix string) (*Config, error) {
+	scope := "config.load"
+
+	k := koanf.New(".")
+
+	if len(path) > 0 {
+		parser, err := parserOf(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := k.Load(file.Provider(path), parser); err != nil {
+			return nil, telecrafterror.Wrap(err).Scope(scope).Input(path).Errorf("error to load the config file")
+		}
+	}
+
+	err := k.Load(env.Provider(envPrefix, ".", func(s string) string {
+		return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(s, envPrefix)), "__", ".")
+	}), nil)
+	if err != nil {
+		return nil, telecrafterror.Wrap(err).Scope(scope).Input(envPrefix).Errorf("error to load the environment variables")
+	}
+
+	config := &Config{}
+	if err := k.Unmarshal("", config); err != nil {
+		return nil, telecrafterror.Wrap(err).Scope(scope).BadRequest().Errorf("error to decode the config")
+	}
+	return config, nil
+}
+
+func parserOf(path string) (koanf.Parser, error) {
+	scope := "config.parserOf"
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yaml.Parser(), nil
+	case ".toml":
+		return toml.Parser(), nil
+	}
+	return nil, telecrafterror.Scope(scope).BadRequest().Input(path).Errorf("the format of the config file isn't supported")
+}
+
+func (c *Config) TeleCraftOptions() (*telecraft.TeleCraftOptions, error) {
+	scope := "config.teleCraftOptions"
+
+	telecraftOptions := &telecraft.TeleCraftOptions{
+		Token:           c.Bot.Token,
+		APIEndpoint:     c.Bot.APIEndpoint,
+		RepoType:        c.State.Type,
+		DefaultRoute:    c.Bot.DefaultRoute,
+		StateTTL:        c.State.TTL,
+		MaxGoroutines:   c.Bot.MaxGoroutines,
+		Timeout:         c.Bot.Timeout,
+		QueueSize:       c.Bot.QueueSize,
+		BusyMessage:     c.Bot.BusyMessage,
+		ErrorMessage:    c.Bot.ErrorMessage,
+		ShutdownTimeout: c.Bot.ShutdownTimeout,
+		MaxSendAttempts: c.Bot.MaxSendAttempts,
+		RetryBackoff:    c.Bot.RetryBackoff,
+		MaxRetryDelay:   c.Bot.MaxRetryDelay,
+		OutboxPath:      c.Bot.OutboxPath,
+	}
+
+	if len(c.Bot.OverflowPolicy) > 0 {
+		overflowPolicy, ok := overflowPolicies[c.Bot.OverflowPolicy]
+		if !ok {
+			return nil, telecrafterror.Scope(scope).BadRequest().Input(c.Bot.OverflowPolicy).Errorf("the overflow policy is unknown")
+		}
+		telecraftOptions.OverflowPolicy = overflowPolicy
+	}
+
+	rateLimits, err := c.rateLimits()
+	if err != nil {
+		return nil, err
+	}
+	telecraftOptions.RateLimits = rateLimits
+
+	if len(c.State.KeyStrategy) > 0 {
+		keyStrategy, ok := keyStrategies[c.State.KeyStrategy]
+		if !ok {
+			return nil, telecrafterror.Scope(scope).BadRequest().Input(c.State.KeyStrategy).Errorf("the key strategy is unknown")
+		}
+		telecraftOptions.StateKeyStrategy = keyStrategy
+	}
+
+	return telecraftOptions, nil
+}
+
+func (c *Config) rateLimits() (*ratelimit.Limits, error) {
+	limits := ratelimit.TelegramLimits()
+
+	for _, rateLimit := range []struct {
+		text  string
+		limit *ratelimit.Limit
+	}{
+		{text: c.Bot.GlobalRateLimit, limit: &limits.Global},
+		{text: c.Bot.ChatRateLimit, limit: &limits.Chat},
+		{text: c.Bot.GroupRateLimit, limit: &limits.Group},
+	} {
+		if len(rateLimit.text) == 0 {
+			continue
+		}
+		limit, err := ratelimit.ParseLimit(rateLimit.text)
+		if err != nil {
+			return nil, err
+		}
+		*rateLimit.limit = limit
+	}
+	return &limits, nil
+}
+
+// WebhookOptions returns nil when no webhook url is configured, meaning the
+// bot should long poll.
+func (c *Config) WebhookOptions() *telecraft.WebhookOptions {
+	if len(c.Webhook.URL) == 0 {
+		return nil
+	}
+
+	return &telecraft.WebhookOptions{
+		URL:                c.Webhook.URL,
+		ListenAddr:         c.Webhook.ListenAddr,
+		Path:               c.Webhook.Path,
+		SecretToken:        c.Webhook.SecretToken,
+		CertFile:           c.Webhook.CertFile,
+		KeyFile:            c.Webhook.KeyFile,
+		UploadCertificate:  c.Webhook.UploadCertificate,
+		MaxConnections:     c.Webhook.MaxConnections,
+		AllowedUpdates:     c.Webhook.AllowedUpdates,
+		DropPendingUpdates: c.Webhook.DropPendingUpdates,
+	}
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohamadrezamomeni/telecraft/dispatcher"
+	"github.com/mohamadrezamomeni/telecraft/pkg/log"
+	"github.com/mohamadrezamomeni/telecraft/ratelimit"
+)
+
+const yamlConfig = `
+bot:
+  token: file-token
+  default_route: start
+  max_goroutines: 4
+  overflow_policy: reject
+  shutdown_timeout: 10s
+  max_send_attempts: 5
+  chat_rate_limit: 2/1s
+state:
+  type: cache
+  ttl: 5m
+  key_strategy: user_in_chat
+webhook:
+  url: https://bot.example.com/telegram
+  listen_addr: ":8443"
+  allowed_updates: [message, callback_query]
+log:
+  error_file: error.log
+`
+
+const tomlConfig = `
+[bot]
+token = "file-token"
+default_route = "start"
+max_goroutines = 4
+overflow_policy = "reject"
+shutdown_timeout = "10s"
+max_send_attempts = 5
+chat_rate_limit = "2/1s"
+
+[state]
+type = "cache"
+ttl = "5m"
+key_strategy = "user_in_chat"
+
+[webhook]
+url = "https://bot.example.com/telegram"
+listen_addr = ":8443"
+allowed_updates = ["message", "callback_query"]
+
+[log]
+error_file = "error.log"
+`
+
+func writeConfig(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("error to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	for i, testCase := range []struct {
+		name    string
+		content string
+	}{
+		{name: "telecraft.yaml", content: yamlConfig},
+		{name: "telecraft.toml", content: tomlConfig},
+	} {
+		t.Setenv("TELECRAFT_BOT__TOKEN", "env-token")
+		t.Setenv("TELECRAFT_BOT__MAX_GOROUTINES", "8")
+
+		config, err := Load(writeConfig(t, testCase.name, testCase.content), DefaultEnvPrefix)
+		if err != nil {
+			t.Fatalf("we didn't expect error at %d but we got %v", i, err)
+		}
+
+		if config.Bot.Token != "env-token" || config.Bot.MaxGoroutines != 8 {
+			t.Errorf("the environment must override the file at %d but we got %+v", i, config.Bot)
+		}
+		if config.Bot.DefaultRoute != "start" || config.Webhook.ListenAddr != ":8443" || config.Log.ErrorFile != "error.log" {
+			t.Errorf("the values of the file are missing at %d", i)
+		}
+
+		telecraftOptions, err := config.TeleCraftOptions()
+		if err != nil {
+			t.Fatalf("we didn't expect error at %d but we got %v", i, err)
+		}
+		if telecraftOptions.StateTTL != 5*time.Minute ||
+			telecraftOptions.ShutdownTimeout != 10*time.Second ||
+			telecraftOptions.MaxSendAttempts != 5 ||
+			telecraftOptions.RateLimits.Chat != ratelimit.Every(2, time.Second) ||
+			telecraftOptions.RateLimits.Group != ratelimit.TelegramLimits().Group ||
+			telecraftOptions.OverflowPolicy != dispatcher.Reject ||
+			telecraftOptions.StateKeyStrategy == nil {
+			t.Errorf("the options aren't built well at %d: %+v", i, telecraftOptions)
+		}
+
+		webhookOptions := config.WebhookOptions()
+		if webhookOptions == nil || webhookOptions.ListenAddr != ":8443" || len(webhookOptions.AllowedUpdates) != 2 {
+			t.Errorf("the webhook options aren't built well at %d: %+v", i, webhookOptions)
+		}
+	}
+}
+
+func TestApplyLog(t *testing.T) {
+	dir := t.TempDir()
+	accessFile := filepath.Join(dir, "access.log")
+	errorFile := filepath.Join(dir, "error.log")
+
+	t.Setenv("TELECRAFT_LOG__ACCESS_FILE", accessFile)
+	t.Setenv("TELECRAFT_LOG__ERROR_FILE", errorFile)
+
+	config, err := Load("", DefaultEnvPrefix)
+	if err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+
+	closer, err := log.Apply(config.Log)
+	if err != nil {
+		t.Fatalf("we didn't expect error on applying the log config but we got %v", err)
+	}
+	log.Info("the bot has started")
+	log.Warrning("the webhook couldn't be deleted")
+	if err := closer.Close(); err != nil {
+		t.Fatalf("we didn't expect error on closing the log files but we got %v", err)
+	}
+	log.Warrning("the files are closed")
+
+	for i, testCase := range []struct {
+		path     string
+		expected []string
+	}{
+		{path: accessFile, expected: []string{"the bot has started", "the webhook couldn't be deleted"}},
+		{path: errorFile, expected: []string{"the webhook couldn't be deleted"}},
+	} {
+		data, err := os.ReadFile(testCase.path)
+		if err != nil {
+			t.Fatalf("we didn't expect error at %d but we got %v", i, err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != len(testCase.expected) {
+			t.Fatalf("we expected %d lines at %d but we got %q", len(testCase.expected), i, lines)
+		}
+		for j, message := range testCase.expected {
+			if !strings.Contains(lines[j], message) {
+				t.Errorf("we expected %q at %d.%d but we got %q", message, i, j, lines[j])
+			}
+		}
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	t.Setenv("TELECRAFT_BOT__TOKEN", "env-token")
+	t.Setenv("TELECRAFT_STATE__TTL", "1m")
+
+	config, err := Load("", DefaultEnvPrefix)
+	if err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+	if config.Bot.Token != "env-token" || config.State.TTL != time.Minute {
+		t.Errorf("the environment isn't loaded %+v", config)
+	}
+	if config.WebhookOptions() != nil {
+		t.Error("we expected no webhook options without url")
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	if _, err := Load(writeConfig(t, "telecraft.ini", ""), DefaultEnvPrefix); err == nil {
+		t.Error("we expected an error for an unsupported format")
+	}
+
+	config := &Config{Bot: BotConfig{OverflowPolicy: "explode"}}
+	if _, err := config.TeleCraftOptions(); err == nil {
+		t.Error("we expected an error for an unknown overflow policy")
+	}
+
+	config = &Config{State: StateConfig{KeyStrategy: "planet"}}
+	if _, err := config.TeleCraftOptions(); err == nil {
+		t.Error("we expected an error for an unknown key strategy")
+	}
+}
@@ -0,0 +1,237 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+)
+
+var ErrQueueFull = errors.New("the queue of dispatcher is full")
+
+type OverflowPolicy int
+
+const (
+	// Block makes Submit wait until the queue has room.
+	Block OverflowPolicy = iota
+	// DropOldest discards the oldest pending job to make room.
+	DropOldest
+	// Reject makes Submit fail with ErrQueueFull.
+	Reject
+)
+
+type Stats struct {
+	Pending  int
+	Running  int
+	Dropped  uint64
+	Rejected uint64
+}
+
+type job struct {
+	keys []string
+	run  func()
+}
+
+// Dispatcher runs jobs on a fixed number of workers. Jobs sharing a key run
+// one at a time in submission order; jobs with different keys, or with an
+// empty key, run in parallel. At most queueSize jobs wait for a worker, a
+// queueSize of zero or less leaves the queue unbounded.
+type Dispatcher struct {
+	mutex     sync.Mutex
+	ready     *sync.Cond
+	space     *sync.Cond
+	pending   []*job
+	busy      map[string]bool
+	running   int
+	dropped   uint64
+	rejected  uint64
+	queueSize int
+	overflow  OverflowPolicy
+	closed    bool
+	done      chan struct{}
+	workers   sync.WaitGroup
+}
+
+func New(workers int, queueSize int, overflow OverflowPolicy) *Dispatcher {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	d := &Dispatcher{
+		busy:      make(map[string]bool),
+		done:      make(chan struct{}),
+		queueSize: queueSize,
+		overflow:  overflow,
+	}
+	d.ready = sync.NewCond(&d.mutex)
+	d.space = sync.NewCond(&d.mutex)
+
+	d.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+
+	go func() {
+		d.workers.Wait()
+		close(d.done)
+	}()
+
+	return d
+}
+
+func (d *Dispatcher) Submit(key string, run func()) error {
+	return d.SubmitKeys([]string{key}, run)
+}
+
+// SubmitKeys submits a job ordered by every key of keys, so it runs after the
+// jobs submitted before it under any of them.
+func (d *Dispatcher) SubmitKeys(keys []string, run func()) error {
+	scope := "dispatcher.submit"
+
+	keys = slices.DeleteFunc(slices.Clone(keys), func(key string) bool { return len(key) == 0 })
+	key := strings.Join(keys, ",")
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for !d.closed && d.isFull() {
+		switch d.overflow {
+		case Reject:
+			d.rejected++
+			return telecrafterror.Wrap(ErrQueueFull).Scope(scope).Input(key).Errorf("the job has been rejected")
+		case DropOldest:
+			dropped := d.pending[0]
+			d.pending = d.pending[1:]
+			d.dropped++
+			telecrafterror.Scope(scope).Input(strings.Join(dropped.keys, ",")).Errorf("the oldest pending job has been dropped")
+		default:
+			d.space.Wait()
+		}
+	}
+
+	if d.closed {
+		return telecrafterror.Scope(scope).Input(key).Errorf("the dispatcher is closed")
+	}
+
+	d.pending = append(d.pending, &job{keys: keys, run: run})
+	d.ready.Signal()
+	return nil
+}
+
+func (d *Dispatcher) isFull() bool {
+	return d.queueSize > 0 && len(d.pending) >= d.queueSize
+}
+
+func (d *Dispatcher) Stats() Stats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return Stats{
+		Pending:  len(d.pending),
+		Running:  d.running,
+		Dropped:  d.dropped,
+		Rejected: d.rejected,
+	}
+}
+
+// Shutdown stops accepting jobs and waits until the pending ones have run or
+// ctx is done.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	scope := "dispatcher.shutdown"
+
+	d.mutex.Lock()
+	d.closed = true
+	d.ready.Broadcast()
+	d.space.Broadcast()
+	d.mutex.Unlock()
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return telecrafterror.Wrap(ctx.Err()).Scope(scope).Errorf("pending jobs didn't finish in time")
+	}
+}
+
+func (d *Dispatcher) IsClosed() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.closed
+}
+
+func (d *Dispatcher) work() {
+	defer d.workers.Done()
+
+	for {
+		j, ok := d.take()
+		if !ok {
+			return
+		}
+
+		j.run()
+
+		d.mutex.Lock()
+		for _, key := range j.keys {
+			delete(d.busy, key)
+		}
+		d.running--
+		d.ready.Broadcast()
+		d.mutex.Unlock()
+	}
+}
+
+func (d *Dispatcher) take() (*job, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for {
+		if i := d.nextRunnable(); i >= 0 {
+			j := d.pending[i]
+			d.pending = append(d.pending[:i], d.pending[i+1:]...)
+			for _, key := range j.keys {
+				d.busy[key] = true
+			}
+			d.running++
+			d.space.Signal()
+			return j, true
+		}
+
+		if d.closed && len(d.pending) == 0 {
+			return nil, false
+		}
+
+		d.ready.Wait()
+	}
+}
+
+// nextRunnable returns the oldest pending job none of whose keys is being
+// processed or held by an older pending job. Since a key is only released
+// after its job has run, the oldest pending job of a key is always the next
+// one in order.
+func (d *Dispatcher) nextRunnable() int {
+	var waiting map[string]bool
+	for i, j := range d.pending {
+		if !d.isHeld(j.keys, waiting) {
+			return i
+		}
+		if waiting == nil {
+			waiting = make(map[string]bool)
+		}
+		for _, key := range j.keys {
+			waiting[key] = true
+		}
+	}
+	return -1
+}
+
+func (d *Dispatcher) isHeld(keys []string, waiting map[string]bool) bool {
+	for _, key := range keys {
+		if d.busy[key] || waiting[key] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mohamadrezamomeni/telecraft/state"
+)
+
+func TestOrderingPerKey(t *testing.T) {
+	d := New(8, 0, Block)
+
+	keys := 20
+	jobsPerKey := 200
+
+	var mutex sync.Mutex
+	got := make(map[string][]int)
+
+	for i := 0; i < jobsPerKey; i++ {
+		for k := 0; k < keys; k++ {
+			key := fmt.Sprintf("chat:%d", k)
+			seq := i
+			d.Submit(key, func() {
+				mutex.Lock()
+				got[key] = append(got[key], seq)
+				mutex.Unlock()
+			})
+		}
+	}
+
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+
+	for key, seqs := range got {
+		if len(seqs) != jobsPerKey {
+			t.Errorf("we expected %d jobs for %s but we got %d", jobsPerKey, key, len(seqs))
+		}
+		for i, seq := range seqs {
+			if seq != i {
+				t.Errorf("the job %d of %s ran at position %d", seq, key, i)
+				break
+			}
+		}
+	}
+}
+
+func TestStateConsistencyUnderLoad(t *testing.T) {
+	repo, err := state.NewRepository("cache")
+	if err != nil {
+		t.Fatalf("failed to create cache state: %v", err)
+	}
+
+	d := New(16, 0, Block)
+
+	keys := 50
+	jobsPerKey := 100
+
+	for i := 0; i < jobsPerKey; i++ {
+		for k := 0; k < keys; k++ {
+			key := strconv.Itoa(k)
+			d.Submit(key, func() {
+				counter := 0
+				if s, ok := repo.Get(key); ok {
+					counter, _ = strconv.Atoi(s.Data["counter"])
+				}
+				repo.Set(key, &state.State{
+					Data:       map[string]string{"counter": strconv.Itoa(counter + 1)},
+					Expiration: time.Now().Add(time.Minute),
+				})
+			})
+		}
+	}
+
+	d.Shutdown(context.Background())
+
+	for k := 0; k < keys; k++ {
+		s, ok := repo.Get(strconv.Itoa(k))
+		if !ok {
+			t.Fatalf("the state of %d is missing", k)
+		}
+		if s.Data["counter"] != strconv.Itoa(jobsPerKey) {
+			t.Errorf("we expected counter of %d be %d but we got %s", k, jobsPerKey, s.Data["counter"])
+		}
+	}
+}
+
+func TestParallelismAcrossKeys(t *testing.T) {
+	workers := 4
+	d := New(workers, 0, Block)
+
+	var running, maxRunning int32
+	release := make(chan struct{})
+
+	for k := 0; k < workers*2; k++ {
+		d.Submit(strconv.Itoa(k), func() {
+			cur := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&maxRunning)
+				if cur <= old || atomic.CompareAndSwapInt32(&maxRunning, old, cur) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&running, -1)
+		})
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&maxRunning) < int32(workers) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	d.Shutdown(context.Background())
+
+	if maxRunning != int32(workers) {
+		t.Errorf("we expected %d jobs running at once but we got %d", workers, maxRunning)
+	}
+}
+
+func TestSameKeyIsSequential(t *testing.T) {
+	d := New(8, 0, Block)
+
+	var running, overlaps int32
+	for i := 0; i < 100; i++ {
+		d.Submit("chat:1", func() {
+			if atomic.AddInt32(&running, 1) > 1 {
+				atomic.AddInt32(&overlaps, 1)
+			}
+			time.Sleep(100 * time.Microsecond)
+			atomic.AddInt32(&running, -1)
+		})
+	}
+	d.Shutdown(context.Background())
+
+	if overlaps != 0 {
+		t.Errorf("we expected jobs of one key never overlap but they overlapped %d times", overlaps)
+	}
+}
+
+func TestSharedKeys(t *testing.T) {
+	d := New(4, 0, Block)
+
+	var mutex sync.Mutex
+	runs := []string{}
+	run := func(name string) func() {
+		return func() {
+			mutex.Lock()
+			runs = append(runs, name)
+			mutex.Unlock()
+		}
+	}
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	d.SubmitKeys([]string{"chat:1", "user:1"}, func() {
+		close(started)
+		<-release
+		run("private")()
+	})
+	<-started
+
+	// the group waits for user 1 and the next update of the group for it
+	d.SubmitKeys([]string{"chat:2", "user:1"}, run("group"))
+	d.SubmitKeys([]string{"chat:2", "user:2"}, run("group of user 2"))
+	d.SubmitKeys([]string{"chat:3", "user:3"}, run("other"))
+
+	waitUntil(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(runs) == 1
+	})
+	close(release)
+	d.Shutdown(context.Background())
+
+	expected := []string{"other", "private", "group", "group of user 2"}
+	if fmt.Sprint(runs) != fmt.Sprint(expected) {
+		t.Errorf("we expected runs %v but we got %v", expected, runs)
+	}
+}
+
+func waitUntil(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("the condition wasn't met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSubmitAfterShutdown(t *testing.T) {
+	d := New(1, 0, Block)
+	d.Shutdown(context.Background())
+
+	if err := d.Submit("chat:1", func() {}); err == nil {
+		t.Error("we expected an error when submitting to a closed dispatcher")
+	}
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	for i, testCase := range []struct {
+		overflow     OverflowPolicy
+		expectError  bool
+		expectedRuns []int
+		stats        Stats
+	}{
+		{
+			overflow:     Reject,
+			expectError:  true,
+			expectedRuns: []int{0, 1, 2},
+			stats:        Stats{Pending: 2, Running: 1, Rejected: 1},
+		},
+		{
+			overflow:     DropOldest,
+			expectError:  false,
+			expectedRuns: []int{0, 2, 3},
+			stats:        Stats{Pending: 2, Running: 1, Dropped: 1},
+		},
+	} {
+		d := New(1, 2, testCase.overflow)
+
+		var mutex sync.Mutex
+		runs := []int{}
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		d.Submit("chat:1", func() {
+			close(started)
+			<-release
+			mutex.Lock()
+			runs = append(runs, 0)
+			mutex.Unlock()
+		})
+		<-started
+
+		var err error
+		for seq := 1; seq <= 3; seq++ {
+			seq := seq
+			err = d.Submit("chat:1", func() {
+				mutex.Lock()
+				runs = append(runs, seq)
+				mutex.Unlock()
+			})
+		}
+
+		if testCase.expectError && !errors.Is(err, ErrQueueFull) {
+			t.Errorf("we expected ErrQueueFull at %d but we got %v", i, err)
+		}
+		if !testCase.expectError && err != nil {
+			t.Errorf("we didn't expect error at %d but we got %v", i, err)
+		}
+
+		if stats := d.Stats(); stats != testCase.stats {
+			t.Errorf("we expected stats %+v at %d but we got %+v", testCase.stats, i, stats)
+		}
+
+		close(release)
+		d.Shutdown(context.Background())
+
+		if fmt.Sprint(runs) != fmt.Sprint(testCase.expectedRuns) {
+			t.Errorf("we expected runs %v at %d but we got %v", testCase.expectedRuns, i, runs)
+		}
+	}
+}
+
+func TestBlockWaitsForRoom(t *testing.T) {
+	d := New(1, 1, Block)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	d.Submit("chat:1", func() {
+		close(started)
+		<-release
+	})
+	<-started
+	d.Submit("chat:1", func() {})
+
+	submitted := make(chan struct{})
+	go func() {
+		d.Submit("chat:1", func() {})
+		close(submitted)
+	}()
+
+	select {
+	case <-submitted:
+		t.Fatal("we expected submit to block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-submitted:
+	case <-time.After(time.Second):
+		t.Fatal("we expected submit to return once the queue had room")
+	}
+	d.Shutdown(context.Background())
+}
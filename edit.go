@@ -0,0 +1,143 @@
+package telecraft
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/handler"
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+)
+
+// action is a request of a response with what is sent instead when Telegram
+// rejects it, like a new message for an edit of a message that can't be
+// edited anymore.
+type action struct {
+	chattable tgbotapi.Chattable
+	fallback  tgbotapi.Chattable
+	// screen makes the message sent the screen of its chat.
+	screen bool
+}
+
+// actions returns the requests of res. With ReplaceScreen the first message
+// replaces the screen of the chat and with EditOriginal the first message of a
+// response to a callback query edits the message of the pressed button.
+func (t *TeleCraft) actions(res *handler.ResponseHandlerFunc, context *handler.Context) []action {
+	edited := !res.EditOriginal && !res.ReplaceScreen
+	result := []action{}
+	for _, chattable := range res.Actions() {
+		messageConfig, ok := chattable.(*tgbotapi.MessageConfig)
+		if !ok || edited {
+			result = append(result, action{chattable: chattable})
+			continue
+		}
+
+		edited = true
+		switch {
+		case res.ReplaceScreen:
+			result = append(result, t.screenAction(context, messageConfig))
+		default:
+			if edit := editOriginal(context, messageConfig); edit != nil {
+				result = append(result, action{chattable: edit, fallback: fallbackOf(messageConfig)})
+			} else {
+				result = append(result, action{chattable: chattable})
+			}
+		}
+	}
+	return result
+}
+
+// editOriginal turns messageConfig into an edit of the message carrying the
+// pressed button. It is nil when there is no such message.
+func editOriginal(context *handler.Context, messageConfig *tgbotapi.MessageConfig) tgbotapi.Chattable {
+	callbackQuery := context.CallbackQuery
+	if callbackQuery == nil || (callbackQuery.Message == nil && len(callbackQuery.InlineMessageID) == 0) {
+		return nil
+	}
+
+	baseEdit := tgbotapi.BaseEdit{InlineMessageID: callbackQuery.InlineMessageID}
+	if callbackQuery.Message != nil {
+		baseEdit.ChatID = callbackQuery.Message.Chat.ID
+		baseEdit.MessageID = callbackQuery.Message.MessageID
+	}
+	return editMessage(baseEdit, messageConfig)
+}
+
+// editMessage turns messageConfig into an edit of the message of baseEdit:
+// its text, or only its keyboard when the text is empty. It is nil when the
+// reply markup isn't an inline keyboard, which an edit can't carry.
+func editMessage(baseEdit tgbotapi.BaseEdit, messageConfig *tgbotapi.MessageConfig) tgbotapi.Chattable {
+	switch markup := messageConfig.ReplyMarkup.(type) {
+	case nil:
+	case tgbotapi.InlineKeyboardMarkup:
+		baseEdit.ReplyMarkup = &markup
+	case *tgbotapi.InlineKeyboardMarkup:
+		baseEdit.ReplyMarkup = markup
+	default:
+		return nil
+	}
+
+	if len(messageConfig.Text) == 0 {
+		return tgbotapi.EditMessageReplyMarkupConfig{BaseEdit: baseEdit}
+	}
+	return tgbotapi.EditMessageTextConfig{
+		BaseEdit:              baseEdit,
+		Text:                  messageConfig.Text,
+		ParseMode:             messageConfig.ParseMode,
+		Entities:              messageConfig.Entities,
+		DisableWebPagePreview: messageConfig.DisableWebPagePreview,
+	}
+}
+
+// fallbackOf is the message sent when the edit fails; a message of an inline
+// query has no chat and an empty one only edits the keyboard, so neither has
+// one.
+func fallbackOf(messageConfig *tgbotapi.MessageConfig) tgbotapi.Chattable {
+	if messageConfig.ChatID == 0 || len(messageConfig.Text) == 0 {
+		return nil
+	}
+	return messageConfig
+}
+
+// sendAction requests action and its fallback when Telegram rejects it. It
+// returns the chattable which was sent last.
+func (t *TeleCraft) sendAction(a action) (tgbotapi.Chattable, tgbotapi.Message, error) {
+	message, err := t.request(a.chattable)
+	chattable := a.chattable
+	if err != nil && a.fallback != nil && needsFallback(err) {
+		chattable = a.fallback
+		message, err = t.request(a.fallback)
+	}
+	if err == nil && a.screen {
+		t.replaceScreen(chatIDOf(chattable), message.MessageID)
+	}
+	return chattable, message, err
+}
+
+// uneditable are the descriptions of Telegram for edits of a message which
+// can't be edited, e.g. it is too old, deleted or has no text. Any other
+// failure of an edit would fail the new message the same way.
+var uneditable = []string{
+	"message to edit not found",
+	"message can't be edited",
+	"there is no text in the message to edit",
+}
+
+// needsFallback reports whether an edit failed because the message can't be
+// edited. An edit changing nothing fails too, but the message already shows
+// what it should.
+func needsFallback(err error) bool {
+	return hasSendErrorType(err, telecrafterror.BadRequest) && slices.ContainsFunc(uneditable, func(description string) bool {
+		return hasDescription(err, description)
+	})
+}
+
+func isNotModified(err error) bool {
+	return hasDescription(err, "message is not modified")
+}
+
+func hasDescription(err error, description string) bool {
+	var apiError *tgbotapi.Error
+	return errors.As(err, &apiError) && strings.Contains(apiError.Message, description)
+}
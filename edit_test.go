@@ -0,0 +1,108 @@
+package telecraft
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/handler"
+	"github.com/mohamadrezamomeni/telecraft/telecrafttest"
+)
+
+func TestEditOriginal(t *testing.T) {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("next", "/next")))
+
+	for i, testCase := range []struct {
+		text           string
+		replyMarkup    any
+		failure        string
+		callback       bool
+		expected       []string
+		expectedErrors int
+	}{
+		{
+			text:        "page 2",
+			replyMarkup: keyboard,
+			callback:    true,
+			expected:    []string{"editMessageText"},
+		},
+		{
+			replyMarkup: keyboard,
+			callback:    true,
+			expected:    []string{"editMessageReplyMarkup"},
+		},
+		{
+			text:     "page 2",
+			failure:  "Bad Request: message can't be edited",
+			callback: true,
+			expected: []string{"editMessageText", "sendMessage"},
+		},
+		{
+			text:           "page 2",
+			failure:        "Bad Request: can't parse entities",
+			callback:       true,
+			expected:       []string{"editMessageText"},
+			expectedErrors: 1,
+		},
+		{
+			text:     "page 2",
+			failure:  "Bad Request: message is not modified",
+			callback: true,
+			expected: []string{"editMessageText"},
+		},
+		{
+			text:        "page 2",
+			replyMarkup: tgbotapi.NewReplyKeyboard(tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton("next"))),
+			callback:    true,
+			expected:    []string{"sendMessage"},
+		},
+		{
+			text:     "page 2",
+			expected: []string{"sendMessage"},
+		},
+	} {
+		server := telecrafttest.NewServer()
+		bot := newTestBot(t, server)
+
+		sendErrors := 0
+		bot.telecraftOptions.OnSendError = func(_ *handler.Context, _ tgbotapi.Chattable, err error) {
+			sendErrors++
+		}
+		if len(testCase.failure) > 0 {
+			server.Fail("editMessageText", http.StatusBadRequest, testCase.failure, 0)
+		}
+
+		update := &tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, From: &tgbotapi.User{ID: 1}}}
+		if testCase.callback {
+			update = &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+				ID:      "1",
+				From:    &tgbotapi.User{ID: 1},
+				Message: &tgbotapi.Message{MessageID: 10, Chat: &tgbotapi.Chat{ID: 1}},
+			}}
+		}
+		context := handler.NewContext(update)
+
+		msg := tgbotapi.NewMessage(1, testCase.text)
+		msg.ReplyMarkup = testCase.replyMarkup
+		bot.send(&handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&msg},
+			EditOriginal:   true,
+		}, context)
+		server.Close()
+
+		methods := []string{}
+		for _, request := range server.Requests("") {
+			methods = append(methods, request.Method)
+			if strings.HasPrefix(request.Method, "edit") && request.Params.Get("message_id") != "10" {
+				t.Errorf("we expected the edit of message 10 at %d but we got %v", i, request.Params)
+			}
+		}
+		if strings.Join(methods, ",") != strings.Join(testCase.expected, ",") {
+			t.Errorf("we expected %v at %d but we got %v", testCase.expected, i, methods)
+		}
+		if sendErrors != testCase.expectedErrors {
+			t.Errorf("we expected %d send errors at %d but we got %d", testCase.expectedErrors, i, sendErrors)
+		}
+	}
+}
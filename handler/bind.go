@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+)
+
+// binding is the value of a field found in the update.
+type binding struct {
+	name  string
+	text  string
+	args  []string
+	found bool
+}
+
+// Bind fills the fields of target, a pointer to a struct, by their tags:
+//
+//	param:"id"   the route parameter id
+//	query:"page" the value page after ? in the path, like /books?page=2
+//	arg:"0"      the first word after the command; arg:"*" takes all of them
+//	state:"name" the value name of the conversation state
+//
+// Fields can be strings, numbers, bools, or []string for arg:"*". The
+// validate tag checks the value by comma separated rules: required, min=n
+// and max=n, which bound numbers or the length of strings, and regex=, which
+// has to be the last one. A value failing them returns a BadRequest marked as
+// UserFacing, see telecrafterror.UserMessage; the msg tag replaces its
+// message.
+func (c *Context) Bind(target any) error {
+	scope := "handler.context.bind"
+
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return telecrafterror.Scope(scope).UnExpected().Input(fmt.Sprintf("%T", target)).Errorf("the target has to be a pointer to a struct")
+	}
+	value = value.Elem()
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		b, ok := c.lookup(field)
+		if !ok {
+			continue
+		}
+		if err := bindField(value.Field(i), field, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup finds the value of field by the first of its tags; it is false when
+// the field has none.
+func (c *Context) lookup(field reflect.StructField) (binding, bool) {
+	if key, ok := field.Tag.Lookup("param"); ok {
+		value, found := c.Params[key]
+		return binding{name: key, text: value, found: found}, true
+	}
+	if key, ok := field.Tag.Lookup("query"); ok {
+		return binding{name: key, text: c.Query.Get(key), found: c.Query.Has(key)}, true
+	}
+	if key, ok := field.Tag.Lookup("arg"); ok {
+		b := binding{name: strings.ToLower(field.Name)}
+		if key == "*" {
+			b.args = c.Args
+			b.text = strings.Join(c.Args, " ")
+			b.found = len(c.Args) > 0
+		} else if index, err := strconv.Atoi(key); err == nil && index >= 0 && index < len(c.Args) {
+			b.text = c.Args[index]
+			b.found = true
+		}
+		return b, true
+	}
+	if key, ok := field.Tag.Lookup("state"); ok {
+		value, found := c.Data[key]
+		b := binding{name: key, found: found}
+		if found {
+			b.text = fmt.Sprint(value)
+		}
+		return b, true
+	}
+	return binding{}, false
+}
+
+func bindField(value reflect.Value, field reflect.StructField, b binding) error {
+	scope := "handler.context.bind"
+
+	rules := parseRules(field.Tag.Get("validate"))
+
+	invalid := func(message string, args ...any) error {
+		if msg, ok := field.Tag.Lookup("msg"); ok {
+			message, args = "%s", []any{msg}
+		}
+		return telecrafterror.Scope(scope).BadRequest().UserFacing().Input(field.Name, b.text).DebuggingErrorf(message, args...)
+	}
+	unbindable := func() error {
+		return telecrafterror.Scope(scope).UnExpected().Input(field.Name, field.Type.String()).Errorf("the field can't be bound")
+	}
+
+	if !b.found || len(b.text) == 0 {
+		if _, required := rules["required"]; required {
+			return invalid("%s is required", b.name)
+		}
+		return nil
+	}
+
+	size := float64(utf8.RuneCountInString(b.text))
+	unit := " characters"
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(b.text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(b.text, 10, value.Type().Bits())
+		if err != nil {
+			return invalid("%s must be a whole number", b.name)
+		}
+		value.SetInt(n)
+		size, unit = float64(n), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(b.text, 10, value.Type().Bits())
+		if err != nil {
+			return invalid("%s must be a positive whole number", b.name)
+		}
+		value.SetUint(n)
+		size, unit = float64(n), ""
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(b.text, value.Type().Bits())
+		if err != nil {
+			return invalid("%s must be a number", b.name)
+		}
+		value.SetFloat(n)
+		size, unit = n, ""
+	case reflect.Bool:
+		v, err := strconv.ParseBool(b.text)
+		if err != nil {
+			return invalid("%s must be true or false", b.name)
+		}
+		value.SetBool(v)
+	case reflect.Slice:
+		if b.args == nil || value.Type().Elem().Kind() != reflect.String {
+			return unbindable()
+		}
+		value.Set(reflect.ValueOf(append([]string{}, b.args...)))
+	default:
+		return unbindable()
+	}
+
+	for _, rule := range []string{"min", "max"} {
+		limit, ok := rules[rule]
+		if !ok {
+			continue
+		}
+		bound, err := strconv.ParseFloat(limit, 64)
+		if err != nil {
+			return telecrafterror.Wrap(err).Scope(scope).UnExpected().Input(field.Name, limit).Errorf("the %s rule isn't a number", rule)
+		}
+		if rule == "min" && size < bound {
+			return invalid("%s must be at least %s%s", b.name, limit, unit)
+		}
+		if rule == "max" && size > bound {
+			return invalid("%s must be at most %s%s", b.name, limit, unit)
+		}
+	}
+
+	if expression, ok := rules["regex"]; ok {
+		pattern, err := regexp.Compile(expression)
+		if err != nil {
+			return telecrafterror.Wrap(err).Scope(scope).UnExpected().Input(field.Name, expression).Errorf("the regex rule isn't valid")
+		}
+		if !pattern.MatchString(b.text) {
+			return invalid("%s isn't valid", b.name)
+		}
+	}
+	return nil
+}
+
+// parseRules splits the validate tag into its rules; regex= takes the rest
+// of the tag, commas included.
+func parseRules(tag string) map[string]string {
+	rules := make(map[string]string)
+	for len(tag) > 0 {
+		if strings.HasPrefix(tag, "regex=") {
+			rules["regex"] = strings.TrimPrefix(tag, "regex=")
+			break
+		}
+
+		rule, rest, _ := strings.Cut(tag, ",")
+		key, value, _ := strings.Cut(rule, "=")
+		rules[strings.TrimSpace(key)] = value
+		tag = strings.TrimSpace(rest)
+	}
+	return rules
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+)
+
+type bookForm struct {
+	ID       int      `param:"id" validate:"required,min=1"`
+	Page     uint     `query:"page" validate:"max=100"`
+	Title    string   `arg:"0" validate:"min=2,max=10"`
+	Words    []string `arg:"*"`
+	Lang     string   `state:"lang" validate:"regex=^(en|fa)$"`
+	Age      int      `state:"age" msg:"please send your age as a number"`
+	internal string
+}
+
+func TestBind(t *testing.T) {
+	for i, testCase := range []struct {
+		context  *Context
+		expected bookForm
+		message  string
+	}{
+		{
+			context: &Context{
+				Params: map[string]string{"id": "7"},
+				Query:  url.Values{"page": {"2"}},
+				Args:   []string{"dune", "messiah"},
+				Data:   map[string]any{"lang": "fa", "age": "30"},
+			},
+			expected: bookForm{ID: 7, Page: 2, Title: "dune", Words: []string{"dune", "messiah"}, Lang: "fa", Age: 30},
+		},
+		{
+			context:  &Context{Params: map[string]string{"id": "7"}},
+			expected: bookForm{ID: 7},
+		},
+		{
+			context: &Context{},
+			message: "id is required",
+		},
+		{
+			context: &Context{Params: map[string]string{"id": "seven"}},
+			message: "id must be a whole number",
+		},
+		{
+			context: &Context{Params: map[string]string{"id": "0"}},
+			message: "id must be at least 1",
+		},
+		{
+			context: &Context{Params: map[string]string{"id": "7"}, Query: url.Values{"page": {"101"}}},
+			message: "page must be at most 100",
+		},
+		{
+			context: &Context{Params: map[string]string{"id": "7"}, Args: []string{"a"}},
+			message: "title must be at least 2 characters",
+		},
+		{
+			context: &Context{Params: map[string]string{"id": "7"}, Data: map[string]any{"lang": "de"}},
+			message: "lang isn't valid",
+		},
+		{
+			context: &Context{Params: map[string]string{"id": "7"}, Data: map[string]any{"age": "old"}},
+			message: "please send your age as a number",
+		},
+	} {
+		var form bookForm
+		err := testCase.context.Bind(&form)
+
+		if len(testCase.message) > 0 {
+			e, ok := telecrafterror.GetMomoError(err)
+			if !ok || e.GetErrorType() != telecrafterror.BadRequest {
+				t.Errorf("we expected a bad request at %d but we got %v", i, err)
+				continue
+			}
+			if e.Message() != testCase.message {
+				t.Errorf("we expected the message %q at %d but we got %q", testCase.message, i, e.Message())
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("we didn't expect error at %d but we got %v", i, err)
+			continue
+		}
+		if form.ID != testCase.expected.ID || form.Page != testCase.expected.Page || form.Title != testCase.expected.Title ||
+			strings.Join(form.Words, " ") != strings.Join(testCase.expected.Words, " ") ||
+			form.Lang != testCase.expected.Lang || form.Age != testCase.expected.Age {
+			t.Errorf("we expected %+v at %d but we got %+v", testCase.expected, i, form)
+		}
+	}
+}
+
+func TestBindInvalidTarget(t *testing.T) {
+	context := &Context{Params: map[string]string{"id": "7"}}
+
+	for i, target := range []any{
+		bookForm{},
+		&struct {
+			ID map[string]string `param:"id"`
+		}{},
+		&struct {
+			ID int `param:"id" validate:"min=one"`
+		}{},
+	} {
+		err := context.Bind(target)
+		if e, ok := telecrafterror.GetMomoError(err); !ok || e.GetErrorType() != telecrafterror.UnExpected {
+			t.Errorf("we expected an unexpected error at %d but we got %v", i, err)
+		}
+	}
+}
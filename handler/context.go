@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+	"github.com/mohamadrezamomeni/telecraft/pkg/utils"
+)
+
+// NewContext fills the sender and chat fields of a Context from whichever part
+// of the update is set.
+func NewContext(update *tgbotapi.Update) *Context {
+	context := &Context{
+		Update: update,
+	}
+
+	context.Sender = senderOf(update)
+	context.Chat = chatOf(update)
+
+	if context.Sender != nil {
+		context.UserID = strconv.FormatInt(context.Sender.ID, 10)
+		context.Username = context.Sender.UserName
+		context.LanguageCode = context.Sender.LanguageCode
+	}
+
+	if context.Chat != nil {
+		context.ChatID = context.Chat.ID
+	}
+
+	return context
+}
+
+func senderOf(update *tgbotapi.Update) *tgbotapi.User {
+	switch {
+	case update.PollAnswer != nil:
+		return &update.PollAnswer.User
+	case update.MyChatMember != nil:
+		return &update.MyChatMember.From
+	case update.ChatMember != nil:
+		return &update.ChatMember.From
+	case update.ChatJoinRequest != nil:
+		return &update.ChatJoinRequest.From
+	}
+	return update.SentFrom()
+}
+
+func chatOf(update *tgbotapi.Update) *tgbotapi.Chat {
+	switch {
+	case update.CallbackQuery != nil:
+		if update.CallbackQuery.Message == nil {
+			return nil
+		}
+		return update.CallbackQuery.Message.Chat
+	case update.MyChatMember != nil:
+		return &update.MyChatMember.Chat
+	case update.ChatMember != nil:
+		return &update.ChatMember.Chat
+	case update.ChatJoinRequest != nil:
+		return &update.ChatJoinRequest.Chat
+	}
+	return update.FromChat()
+}
+
+func (c *Context) SenderID() int64 {
+	if c.Sender == nil {
+		return 0
+	}
+	return c.Sender.ID
+}
+
+func (c *Context) HasChat() bool {
+	return c.ChatID != 0
+}
+
+func (c *Context) IsPrivate() bool {
+	return c.Chat != nil && c.Chat.IsPrivate()
+}
+
+func (c *Context) IsGroup() bool {
+	return c.Chat != nil && (c.Chat.IsGroup() || c.Chat.IsSuperGroup())
+}
+
+// ParamInt returns the route parameter name as an int. Routes like
+// books/:id<int> make sure it is one.
+func (c *Context) ParamInt(name string) (int, error) {
+	scope := "handler.context.paramInt"
+
+	value, ok := c.Params[name]
+	if !ok {
+		return 0, telecrafterror.Scope(scope).BadRequest().Input(name).Errorf("the param doesn't exist")
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, telecrafterror.Wrap(err).Scope(scope).BadRequest().Input(name, value).Errorf("the param isn't an integer")
+	}
+	return number, nil
+}
+
+// ParamUUID returns the route parameter name as a UUID in lower case.
+func (c *Context) ParamUUID(name string) (string, error) {
+	scope := "handler.context.paramUUID"
+
+	value, ok := c.Params[name]
+	if !ok {
+		return "", telecrafterror.Scope(scope).BadRequest().Input(name).Errorf("the param doesn't exist")
+	}
+	if !utils.IsUUID(value) {
+		return "", telecrafterror.Scope(scope).BadRequest().Input(name, value).Errorf("the param isn't a uuid")
+	}
+	return strings.ToLower(value), nil
+}
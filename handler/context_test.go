@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestNewContext(t *testing.T) {
+	user := &tgbotapi.User{ID: 7, UserName: "mic", LanguageCode: "fa"}
+	group := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	private := &tgbotapi.Chat{ID: 7, Type: "private"}
+
+	for i, testCase := range []struct {
+		update       *tgbotapi.Update
+		userID       string
+		chatID       int64
+		username     string
+		languageCode string
+		isPrivate    bool
+		isGroup      bool
+	}{
+		{
+			update:       &tgbotapi.Update{Message: &tgbotapi.Message{From: user, Chat: private}},
+			userID:       "7",
+			chatID:       7,
+			username:     "mic",
+			languageCode: "fa",
+			isPrivate:    true,
+		},
+		{
+			update:       &tgbotapi.Update{EditedMessage: &tgbotapi.Message{From: user, Chat: group}},
+			userID:       "7",
+			chatID:       -100,
+			username:     "mic",
+			languageCode: "fa",
+			isGroup:      true,
+		},
+		{
+			update:       &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: user, Message: &tgbotapi.Message{Chat: group}}},
+			userID:       "7",
+			chatID:       -100,
+			username:     "mic",
+			languageCode: "fa",
+			isGroup:      true,
+		},
+		{
+			update:       &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: user, InlineMessageID: "1"}},
+			userID:       "7",
+			chatID:       0,
+			username:     "mic",
+			languageCode: "fa",
+		},
+		{
+			update:       &tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{From: user}},
+			userID:       "7",
+			chatID:       0,
+			username:     "mic",
+			languageCode: "fa",
+		},
+		{
+			update:       &tgbotapi.Update{ChatJoinRequest: &tgbotapi.ChatJoinRequest{From: *user, Chat: *group}},
+			userID:       "7",
+			chatID:       -100,
+			username:     "mic",
+			languageCode: "fa",
+			isGroup:      true,
+		},
+		{
+			update:       &tgbotapi.Update{PollAnswer: &tgbotapi.PollAnswer{User: *user}},
+			userID:       "7",
+			chatID:       0,
+			username:     "mic",
+			languageCode: "fa",
+		},
+		{
+			update: &tgbotapi.Update{ChannelPost: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -200, Type: "channel"}}},
+			userID: "",
+			chatID: -200,
+		},
+	} {
+		context := NewContext(testCase.update)
+
+		if context.UserID != testCase.userID {
+			t.Errorf("we expected userID %s but we got %s at %d", testCase.userID, context.UserID, i)
+		}
+		if context.ChatID != testCase.chatID {
+			t.Errorf("we expected chatID %d but we got %d at %d", testCase.chatID, context.ChatID, i)
+		}
+		if context.Username != testCase.username {
+			t.Errorf("we expected username %s but we got %s at %d", testCase.username, context.Username, i)
+		}
+		if context.LanguageCode != testCase.languageCode {
+			t.Errorf("we expected language code %s but we got %s at %d", testCase.languageCode, context.LanguageCode, i)
+		}
+		if context.IsPrivate() != testCase.isPrivate {
+			t.Errorf("the private flag is not matched at %d", i)
+		}
+		if context.IsGroup() != testCase.isGroup {
+			t.Errorf("the group flag is not matched at %d", i)
+		}
+	}
+}
+
+func TestTypedParams(t *testing.T) {
+	context := &Context{Params: map[string]string{
+		"id":    "42",
+		"order": "4F3C2A10-9B7D-4E21-8C55-0D6E1F2A3B4C",
+		"slug":  "go",
+	}}
+
+	for i, testCase := range []struct {
+		name     string
+		expected int
+		isValid  bool
+	}{
+		{name: "id", expected: 42, isValid: true},
+		{name: "slug"},
+		{name: "missing"},
+	} {
+		number, err := context.ParamInt(testCase.name)
+		if (err == nil) != testCase.isValid || number != testCase.expected {
+			t.Errorf("we expected %d with valid %v at %d but we got %d, %v", testCase.expected, testCase.isValid, i, number, err)
+		}
+	}
+
+	for i, testCase := range []struct {
+		name     string
+		expected string
+		isValid  bool
+	}{
+		{name: "order", expected: "4f3c2a10-9b7d-4e21-8c55-0d6e1f2a3b4c", isValid: true},
+		{name: "id"},
+		{name: "missing"},
+	} {
+		uuid, err := context.ParamUUID(testCase.name)
+		if (err == nil) != testCase.isValid || uuid != testCase.expected {
+			t.Errorf("we expected %s with valid %v at %d but we got %s, %v", testCase.expected, testCase.isValid, i, uuid, err)
+		}
+	}
+}
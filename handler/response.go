@@ -0,0 +1,66 @@
+package handler
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/pkg/textsplit"
+)
+
+// Send appends chattables to the response, so handlers can chain it.
+func (res *ResponseHandlerFunc) Send(chattables ...tgbotapi.Chattable) *ResponseHandlerFunc {
+	res.Chattables = append(res.Chattables, chattables...)
+	return res
+}
+
+// Actions returns everything the response sends, MessageConfigs first.
+// Messages longer than Telegram allows are split into several.
+func (res *ResponseHandlerFunc) Actions() []tgbotapi.Chattable {
+	actions := make([]tgbotapi.Chattable, 0, len(res.MessageConfigs)+len(res.Chattables))
+	for _, messageConfig := range res.MessageConfigs {
+		if messageConfig != nil {
+			actions = append(actions, splitMessage(messageConfig)...)
+		}
+	}
+	for _, chattable := range res.Chattables {
+		switch c := chattable.(type) {
+		case nil:
+		case *tgbotapi.MessageConfig:
+			if c != nil {
+				actions = append(actions, splitMessage(c)...)
+			}
+		case tgbotapi.MessageConfig:
+			actions = append(actions, splitMessage(&c)...)
+		default:
+			actions = append(actions, chattable)
+		}
+	}
+	return actions
+}
+
+// splitMessage breaks a message longer than textsplit.MaxMessageLength at
+// paragraph and line boundaries. Only the first chunk replies to a message
+// and only the last one has the reply markup. Messages with explicit entities
+// are left whole, as their offsets can't be split.
+func splitMessage(messageConfig *tgbotapi.MessageConfig) []tgbotapi.Chattable {
+	if len(messageConfig.Entities) > 0 {
+		return []tgbotapi.Chattable{messageConfig}
+	}
+
+	texts := textsplit.Split(messageConfig.Text, textsplit.MaxMessageLength, messageConfig.ParseMode)
+	if len(texts) == 1 {
+		return []tgbotapi.Chattable{messageConfig}
+	}
+
+	chunks := make([]tgbotapi.Chattable, 0, len(texts))
+	for i, text := range texts {
+		chunk := *messageConfig
+		chunk.Text = text
+		if i > 0 {
+			chunk.ReplyToMessageID = 0
+		}
+		if i < len(texts)-1 {
+			chunk.ReplyMarkup = nil
+		}
+		chunks = append(chunks, &chunk)
+	}
+	return chunks
+}
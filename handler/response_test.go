@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestActionsSplitLongMessages(t *testing.T) {
+	paragraph := strings.Repeat("a", 3000)
+	msg := tgbotapi.NewMessage(1, paragraph+"\n\n"+paragraph)
+	msg.ReplyToMessageID = 5
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("ok", "ok")))
+	photo := tgbotapi.NewPhoto(1, tgbotapi.FileID("photo"))
+
+	res := &ResponseHandlerFunc{MessageConfigs: []*tgbotapi.MessageConfig{&msg}}
+	actions := res.Send(photo).Actions()
+
+	if len(actions) != 3 {
+		t.Fatalf("we expected 3 actions but we got %d", len(actions))
+	}
+	for i, expected := range []struct {
+		replyTo     int
+		replyMarkup bool
+	}{
+		{replyTo: 5, replyMarkup: false},
+		{replyTo: 0, replyMarkup: true},
+	} {
+		chunk := actions[i].(*tgbotapi.MessageConfig)
+		if chunk.Text != paragraph {
+			t.Errorf("we expected a paragraph at %d but we got %d characters", i, len(chunk.Text))
+		}
+		if chunk.ReplyToMessageID != expected.replyTo {
+			t.Errorf("we expected reply to %d at %d but we got %d", expected.replyTo, i, chunk.ReplyToMessageID)
+		}
+		if (chunk.ReplyMarkup != nil) != expected.replyMarkup {
+			t.Errorf("we expected reply markup %v at %d but we got %v", expected.replyMarkup, i, chunk.ReplyMarkup)
+		}
+	}
+	if _, ok := actions[2].(tgbotapi.PhotoConfig); !ok {
+		t.Errorf("we expected the photo last but we got %T", actions[2])
+	}
+	if msg.ReplyMarkup == nil || len(msg.Text) != 6002 {
+		t.Errorf("we didn't expect the original message to change")
+	}
+}
@@ -1,22 +1,60 @@
 package handler
 
 import (
+	"net/url"
+
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 type ResponseHandlerFunc struct {
 	MessageConfigs []*tgbotapi.MessageConfig
-	ReleaseState   bool
-	RedirectRoot   bool
-	Data           map[string]string
-	Path           string
+	// Chattables are sent after MessageConfigs, in order; they can be any
+	// request like a photo, an edit, a deletion or a chat action.
+	Chattables []tgbotapi.Chattable
+	// CallbackAnswer answers the callback query of the update; without it an
+	// empty answer is sent, which only stops the spinner of the button.
+	CallbackAnswer *CallbackAnswer
+	// EditOriginal makes the first message of a response to a callback query
+	// edit the message of the pressed button instead, or its keyboard only
+	// when the text is empty. A new message is sent when it can't be edited.
+	EditOriginal bool
+	// ReplaceScreen makes the first message of the response the screen of the
+	// chat, the one message a single-message UI keeps up to date. A callback
+	// query edits the screen in place; other updates send a new one and
+	// delete the old. It takes precedence over EditOriginal.
+	ReplaceScreen bool
+	ReleaseState  bool
+	RedirectRoot  bool
+	Data          map[string]string
+	Path          string
+}
+
+// CallbackAnswer is shown to the user who pressed an inline button, as a
+// toast or, with ShowAlert, as an alert. CacheTime is in seconds.
+type CallbackAnswer struct {
+	Text      string
+	ShowAlert bool
+	URL       string
+	CacheTime int
 }
 
 type Context struct {
 	*tgbotapi.Update
+	// Data holds the data of the conversation state the update was routed by.
 	Data   map[string]any
 	Params map[string]string
-	UserID string
+	// Query holds the values after ? in the path, like page of /books?page=2.
+	Query url.Values
+	// Args are the words after the path of a command, like harry and potter
+	// of /search harry potter.
+	Args            []string
+	UserID          string
+	ChatID          int64
+	MessageThreadID int
+	LanguageCode    string
+	Username        string
+	Sender          *tgbotapi.User
+	Chat            *tgbotapi.Chat
 }
 
 type HandlerFunc = func(*Context) (*ResponseHandlerFunc, error)
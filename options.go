@@ -0,0 +1,167 @@
+package telecraft
+
+import (
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/dispatcher"
+	"github.com/mohamadrezamomeni/telecraft/handler"
+	"github.com/mohamadrezamomeni/telecraft/outbox"
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+	"github.com/mohamadrezamomeni/telecraft/ratelimit"
+	"github.com/mohamadrezamomeni/telecraft/router"
+)
+
+const (
+	DefaultRepoType        = "cache"
+	DefaultRoute           = "root"
+	DefaultMaxGoroutines   = 10
+	DefaultTimeout         = 30
+	DefaultQueueSize       = 1024
+	DefaultStateTTL        = 2 * time.Minute
+	DefaultShutdownTimeout = 30 * time.Second
+	DefaultMaxSendAttempts = 3
+	DefaultRetryBackoff    = time.Second
+	DefaultMaxRetryDelay   = 30 * time.Second
+)
+
+// UnboundedQueueSize as QueueSize lets any number of updates wait for a
+// handler, so no overflow policy ever applies.
+const UnboundedQueueSize = -1
+
+// TeleCraftOptions configures New. Zero fields take the Default values above,
+// only Token, or Client, is required.
+type TeleCraftOptions struct {
+	Token string
+	// APIEndpoint points the default client to another Bot API server, like a
+	// local one; it is a format taking the token and the method.
+	APIEndpoint string
+	// Client replaces the tgbotapi client, e.g. by a fake in tests; Token and
+	// APIEndpoint are ignored then.
+	Client BotClient
+	// RepoType is the backend of conversation states, only "cache" for now.
+	RepoType string
+	// DefaultRoute handles updates matching no route and no state.
+	DefaultRoute string
+	// StateTTL is how long a conversation state lives without a new update.
+	StateTTL time.Duration
+	// StateKeyStrategy scopes conversation states; it defaults to router.KeyByUser.
+	StateKeyStrategy router.KeyStrategy
+	// MaxGoroutines is the number of updates handled concurrently.
+	MaxGoroutines int
+	// Timeout is the long polling timeout in seconds.
+	Timeout int
+	// QueueSize caps the updates waiting for a free handler; zero takes
+	// DefaultQueueSize and UnboundedQueueSize removes the cap.
+	QueueSize int
+	// OverflowPolicy decides what happens to an update arriving at a full queue.
+	OverflowPolicy dispatcher.OverflowPolicy
+	// BusyMessage is replied to updates rejected by the Reject overflow policy
+	// while long polling; a webhook answers them with 429 instead, so Telegram
+	// delivers them again. Updates dropped by DropOldest were already
+	// acknowledged and are lost either way. Busy replies are sent one at a
+	// time and dropped when they can't keep up.
+	BusyMessage string
+	// ErrorMessage is replied when a handler fails; empty disables the reply.
+	ErrorMessage string
+	// ShutdownTimeout bounds how long in-flight handlers are waited for once
+	// serving stops.
+	ShutdownTimeout time.Duration
+	// MaxSendAttempts caps how many times a chattable is sent when Telegram
+	// throttles the bot, fails with a 5xx or cannot be reached; 1 disables retries.
+	MaxSendAttempts int
+	// RetryBackoff is the wait before the first retry, doubled for every next
+	// one; a retry_after of Telegram takes its place.
+	RetryBackoff time.Duration
+	// MaxRetryDelay caps the wait before a retry; a send whose retry_after is
+	// longer is given up instead.
+	MaxRetryDelay time.Duration
+	// RateLimits spaces out sends to stay within the limits of Telegram; nil
+	// takes ratelimit.TelegramLimits and zero limits are unlimited.
+	RateLimits *ratelimit.Limits
+	// Outbox turns on the outbox: replies are saved to it before the state is,
+	// and delivered from it in the background, so they survive a crash.
+	Outbox outbox.Store
+	// OutboxPath turns on the outbox with an outbox.FileStore at the path when
+	// Outbox is nil.
+	OutboxPath string
+	// OnSendError is called when a chattable of a response fails to send; see
+	// IsBlocked and IsTooManyRequests to tell the errors apart. The context and
+	// the chattable are nil for replies left in the outbox by a previous run.
+	OnSendError func(*handler.Context, tgbotapi.Chattable, error)
+	// AfterSend is called with the message Telegram returned for every sent
+	// chattable; it is empty for requests like deletions.
+	AfterSend func(*handler.Context, tgbotapi.Chattable, tgbotapi.Message)
+}
+
+func (o TeleCraftOptions) withDefaults() *TeleCraftOptions {
+	if len(o.APIEndpoint) == 0 {
+		o.APIEndpoint = tgbotapi.APIEndpoint
+	}
+	if len(o.RepoType) == 0 {
+		o.RepoType = DefaultRepoType
+	}
+	if len(o.DefaultRoute) == 0 {
+		o.DefaultRoute = DefaultRoute
+	}
+	if o.StateTTL == 0 {
+		o.StateTTL = DefaultStateTTL
+	}
+	if o.StateKeyStrategy == nil {
+		o.StateKeyStrategy = router.KeyByUser
+	}
+	if o.MaxGoroutines == 0 {
+		o.MaxGoroutines = DefaultMaxGoroutines
+	}
+	if o.Timeout == 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.QueueSize == 0 {
+		o.QueueSize = DefaultQueueSize
+	}
+	if o.ShutdownTimeout == 0 {
+		o.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if o.RateLimits == nil {
+		limits := ratelimit.TelegramLimits()
+		o.RateLimits = &limits
+	}
+	if o.MaxSendAttempts == 0 {
+		o.MaxSendAttempts = DefaultMaxSendAttempts
+	}
+	if o.RetryBackoff == 0 {
+		o.RetryBackoff = DefaultRetryBackoff
+	}
+	if o.MaxRetryDelay == 0 {
+		o.MaxRetryDelay = DefaultMaxRetryDelay
+	}
+	return &o
+}
+
+func (o *TeleCraftOptions) validate() error {
+	scope := "telecraft.options.validate"
+
+	switch {
+	case len(o.Token) == 0 && o.Client == nil:
+		return telecrafterror.Scope(scope).BadRequest().Errorf("the token is required")
+	case o.MaxGoroutines < 0:
+		return telecrafterror.Scope(scope).BadRequest().Input(o.MaxGoroutines).Errorf("maxGoroutines must be positive")
+	case o.Timeout < 0:
+		return telecrafterror.Scope(scope).BadRequest().Input(o.Timeout).Errorf("timeout must be positive")
+	case o.QueueSize < UnboundedQueueSize:
+		return telecrafterror.Scope(scope).BadRequest().Input(o.QueueSize).Errorf("queueSize must be positive")
+	case o.StateTTL < 0:
+		return telecrafterror.Scope(scope).BadRequest().Input(o.StateTTL.String()).Errorf("stateTTL must be positive")
+	case o.ShutdownTimeout < 0:
+		return telecrafterror.Scope(scope).BadRequest().Input(o.ShutdownTimeout.String()).Errorf("shutdownTimeout must be positive")
+	case o.MaxSendAttempts < 0:
+		return telecrafterror.Scope(scope).BadRequest().Input(o.MaxSendAttempts).Errorf("maxSendAttempts must be positive")
+	case o.RetryBackoff < 0:
+		return telecrafterror.Scope(scope).BadRequest().Input(o.RetryBackoff.String()).Errorf("retryBackoff must be positive")
+	case o.MaxRetryDelay < 0:
+		return telecrafterror.Scope(scope).BadRequest().Input(o.MaxRetryDelay.String()).Errorf("maxRetryDelay must be positive")
+	case o.OverflowPolicy < dispatcher.Block || o.OverflowPolicy > dispatcher.Reject:
+		return telecrafterror.Scope(scope).BadRequest().Input(int(o.OverflowPolicy)).Errorf("the overflow policy is unknown")
+	}
+	return nil
+}
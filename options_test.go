@@ -0,0 +1,71 @@
+package telecraft
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mohamadrezamomeni/telecraft/dispatcher"
+	"github.com/mohamadrezamomeni/telecraft/ratelimit"
+)
+
+func TestOptionsDefaults(t *testing.T) {
+	options := (&TeleCraftOptions{Token: "token", Timeout: 5}).withDefaults()
+
+	if options.RepoType != DefaultRepoType ||
+		options.DefaultRoute != DefaultRoute ||
+		options.MaxGoroutines != DefaultMaxGoroutines ||
+		options.QueueSize != DefaultQueueSize ||
+		options.StateTTL != DefaultStateTTL ||
+		options.ShutdownTimeout != DefaultShutdownTimeout ||
+		options.MaxSendAttempts != DefaultMaxSendAttempts ||
+		options.RetryBackoff != DefaultRetryBackoff ||
+		options.MaxRetryDelay != DefaultMaxRetryDelay ||
+		options.RateLimits == nil || *options.RateLimits != ratelimit.TelegramLimits() ||
+		options.StateKeyStrategy == nil {
+		t.Errorf("the defaults aren't applied %+v", options)
+	}
+
+	if options.Timeout != 5 {
+		t.Errorf("we expected the timeout be kept but we got %d", options.Timeout)
+	}
+}
+
+func TestOptionsValidation(t *testing.T) {
+	for i, testCase := range []struct {
+		options     TeleCraftOptions
+		expectError bool
+	}{
+		{options: TeleCraftOptions{Token: "token"}, expectError: false},
+		{options: TeleCraftOptions{}, expectError: true},
+		{options: TeleCraftOptions{Token: "token", MaxGoroutines: -1}, expectError: true},
+		{options: TeleCraftOptions{Token: "token", Timeout: -1}, expectError: true},
+		{options: TeleCraftOptions{Token: "token", QueueSize: -2}, expectError: true},
+		{options: TeleCraftOptions{Token: "token", QueueSize: UnboundedQueueSize}, expectError: false},
+		{options: TeleCraftOptions{Token: "token", StateTTL: -time.Second}, expectError: true},
+		{options: TeleCraftOptions{Token: "token", ShutdownTimeout: -time.Second}, expectError: true},
+		{options: TeleCraftOptions{Token: "token", MaxSendAttempts: -1}, expectError: true},
+		{options: TeleCraftOptions{Token: "token", RetryBackoff: -time.Second}, expectError: true},
+		{options: TeleCraftOptions{Token: "token", MaxRetryDelay: -time.Second}, expectError: true},
+		{options: TeleCraftOptions{Token: "token", OverflowPolicy: dispatcher.Reject + 1}, expectError: true},
+	} {
+		err := testCase.options.withDefaults().validate()
+		if testCase.expectError && err == nil {
+			t.Errorf("we expected an error at %d but we got nothing", i)
+		}
+		if !testCase.expectError && err != nil {
+			t.Errorf("we didn't expect error at %d but we got %v", i, err)
+		}
+	}
+}
+
+func TestNewWithNilOptions(t *testing.T) {
+	if _, err := New(nil); err == nil {
+		t.Error("we expected an error for the missing token")
+	}
+}
+
+func TestNewWithUnknownRepoType(t *testing.T) {
+	if _, err := New(&TeleCraftOptions{Token: "token", RepoType: "redis"}); err == nil {
+		t.Error("we expected an error for an unknown repo type")
+	}
+}
@@ -0,0 +1,304 @@
+package telecraft
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/handler"
+	"github.com/mohamadrezamomeni/telecraft/outbox"
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+)
+
+const (
+	captureEndpoint  = "http://outbox/%s%s"
+	maxCaptureMemory = 32 << 20
+)
+
+// outboxSend is what the hooks of a send need and the outbox can't keep; it
+// is lost on restart, so entries left by a previous run call them with nil.
+type outboxSend struct {
+	context   *handler.Context
+	chattable tgbotapi.Chattable
+	fallback  tgbotapi.Chattable
+}
+
+// outboxState is the outbox of a TeleCraft and its background sender.
+type outboxState struct {
+	*outbox.Outbox
+	sends   sync.Map
+	cancel  func()
+	stopped chan struct{}
+}
+
+func newOutbox(telecraftOptions *TeleCraftOptions) (*outboxState, error) {
+	store := telecraftOptions.Outbox
+	if store == nil && len(telecraftOptions.OutboxPath) > 0 {
+		fileStore, err := outbox.NewFileStore(telecraftOptions.OutboxPath)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	}
+	if store == nil {
+		return nil, nil
+	}
+
+	return &outboxState{
+		Outbox: outbox.New(store, telecraftOptions.MaxGoroutines, telecraftOptions.RetryBackoff),
+	}, nil
+}
+
+// commitOutbox is the commit hook of the router when the outbox is on, so the
+// reply is saved before the state moves on.
+func (t *TeleCraft) commitOutbox(context *handler.Context, res *handler.ResponseHandlerFunc) error {
+	scope := "telecraft.commitOutbox"
+
+	entries := []*outbox.Entry{}
+	sends := []outboxSend{}
+	for i, a := range t.actions(res, context) {
+		entry, err := capture(a.chattable)
+		if err != nil {
+			return telecrafterror.Wrap(err).Scope(scope).Input(fmt.Sprintf("%T", a.chattable)).Errorf("error to capture the request")
+		}
+		if a.fallback != nil {
+			if entry.Fallback, err = capture(a.fallback); err != nil {
+				return telecrafterror.Wrap(err).Scope(scope).Input(fmt.Sprintf("%T", a.fallback)).Errorf("error to capture the request")
+			}
+		}
+		entry.ID = outboxID(context, i)
+		entry.Screen = a.screen
+		entries = append(entries, entry)
+		sends = append(sends, outboxSend{context: context, chattable: a.chattable, fallback: a.fallback})
+	}
+
+	// sends are stored before the entries, which may be delivered right away;
+	// an id already stored belongs to the entry the outbox already has
+	stored := []string{}
+	for i, entry := range entries {
+		if _, loaded := t.outbox.sends.LoadOrStore(entry.ID, sends[i]); !loaded {
+			stored = append(stored, entry.ID)
+		}
+	}
+
+	added, err := t.outbox.Add(entries...)
+	for _, id := range stored {
+		if err != nil || !slices.ContainsFunc(added, func(entry *outbox.Entry) bool { return entry.ID == id }) {
+			t.outbox.sends.Delete(id)
+		}
+	}
+	return err
+}
+
+// outboxID is derived from the update, so handling a redelivered update
+// again doesn't send its replies twice.
+func outboxID(context *handler.Context, index int) string {
+	if context.Update != nil && context.UpdateID > 0 {
+		return fmt.Sprintf("update:%d:%d", context.UpdateID, index)
+	}
+	return fmt.Sprintf("local:%d:%d", time.Now().UnixNano(), index)
+}
+
+// deliverOutbox sends entries like send does, with the same rate limiter and
+// retries. Entries failing with errors worth a retry stay in the outbox until
+// their last attempt, which reports the error like any other failure.
+func (t *TeleCraft) deliverOutbox(ctx context.Context) outbox.Deliver {
+	return func(entry *outbox.Entry) error {
+		delivered := entry
+		message, err := t.deliverEntry(ctx, entry)
+		if err != nil && entry.Fallback != nil && needsFallback(err) {
+			delivered = entry.Fallback
+			message, err = t.deliverEntry(ctx, delivered)
+		}
+		if err == nil && entry.Screen {
+			t.replaceScreen(delivered.ChatID, message.MessageID)
+		}
+
+		if err != nil && !t.outbox.IsLastAttempt(entry) {
+			if _, ok := retryDelay(err, 0); ok {
+				return outbox.Retry(err)
+			}
+		}
+
+		var sent outboxSend
+		if value, ok := t.outbox.sends.LoadAndDelete(entry.ID); ok {
+			sent = value.(outboxSend)
+		}
+		chattable := sent.chattable
+		if delivered != entry {
+			chattable = sent.fallback
+		}
+
+		if isNotModified(err) {
+			return nil
+		}
+		if err != nil {
+			t.onSendError(sent.context, chattable, err)
+			return err
+		}
+		if t.telecraftOptions.AfterSend != nil {
+			t.telecraftOptions.AfterSend(sent.context, chattable, message)
+		}
+		return nil
+	}
+}
+
+// FailedReplies returns the entries of the outbox which couldn't be
+// delivered; there are none without the outbox.
+func (t *TeleCraft) FailedReplies() ([]*outbox.Entry, error) {
+	if t.outbox == nil {
+		return nil, nil
+	}
+	return t.outbox.Failed()
+}
+
+func (t *TeleCraft) deliverEntry(ctx context.Context, entry *outbox.Entry) (tgbotapi.Message, error) {
+	resp, err := t.withRetry(ctx, entry.ChatID, func() (*tgbotapi.APIResponse, error) {
+		if len(entry.Files) > 0 {
+			return t.bot.UploadFiles(entry.Method, entry.Params, requestFiles(entry.Files))
+		}
+		return t.bot.MakeRequest(entry.Method, entry.Params)
+	})
+	return decodeMessage(entry.Method, resp, err)
+}
+
+func requestFiles(files []outbox.File) []tgbotapi.RequestFile {
+	requestFiles := make([]tgbotapi.RequestFile, 0, len(files))
+	for _, file := range files {
+		requestFiles = append(requestFiles, tgbotapi.RequestFile{
+			Name: file.Field,
+			Data: tgbotapi.FileBytes{Name: file.Name, Bytes: file.Data},
+		})
+	}
+	return requestFiles
+}
+
+func (t *TeleCraft) startOutbox() {
+	if t.outbox == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.outbox.cancel = cancel
+	t.outbox.stopped = make(chan struct{})
+
+	go func(stopped chan struct{}) {
+		t.outbox.Run(ctx, t.deliverOutbox(ctx))
+		close(stopped)
+	}(t.outbox.stopped)
+}
+
+// stopOutbox waits for the outbox to be delivered until ctx is done; what is
+// left is sent by the next run.
+func (t *TeleCraft) stopOutbox(ctx context.Context) error {
+	scope := "telecraft.stopOutbox"
+
+	if t.outbox == nil {
+		return nil
+	}
+
+	flushErr := t.outbox.Flush(ctx)
+	t.outbox.cancel()
+	<-t.outbox.stopped
+
+	if flushErr != nil {
+		return telecrafterror.Wrap(flushErr).Scope(scope).Errorf("the outbox wasn't delivered in time")
+	}
+	return t.outbox.Close()
+}
+
+// captureClient stands in for the http client of a tgbotapi.BotAPI and keeps
+// the request instead of making it. It is how a chattable, whose params are
+// unexported, turns into an entry of the outbox.
+type captureClient struct {
+	method string
+	params map[string]string
+	files  []outbox.File
+}
+
+func capture(chattable tgbotapi.Chattable) (*outbox.Entry, error) {
+	client := &captureClient{params: make(map[string]string)}
+	bot := &tgbotapi.BotAPI{Client: client}
+	bot.SetAPIEndpoint(captureEndpoint)
+
+	if _, err := bot.Request(chattable); err != nil {
+		return nil, err
+	}
+
+	return &outbox.Entry{
+		ChatID:    chatIDOf(chattable),
+		Method:    client.method,
+		Params:    client.params,
+		Files:     client.files,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func (c *captureClient) Do(request *http.Request) (*http.Response, error) {
+	c.method = path.Base(request.URL.Path)
+
+	mediaType, mediaParams, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := c.readMultipart(request.Body, mediaParams["boundary"]); err != nil {
+			return nil, err
+		}
+	} else {
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			return nil, err
+		}
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		for key := range values {
+			c.params[key] = values.Get(key)
+		}
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"ok":true,"result":true}`)),
+	}, nil
+}
+
+func (c *captureClient) readMultipart(body io.Reader, boundary string) error {
+	form, err := multipart.NewReader(body, boundary).ReadForm(maxCaptureMemory)
+	if err != nil {
+		return err
+	}
+	defer form.RemoveAll()
+
+	for key, values := range form.Value {
+		c.params[key] = values[0]
+	}
+
+	for field, headers := range form.File {
+		for _, header := range headers {
+			file, err := header.Open()
+			if err != nil {
+				return err
+			}
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+			c.files = append(c.files, outbox.File{Field: field, Name: header.Filename, Data: data})
+		}
+	}
+	sort.Slice(c.files, func(i, j int) bool { return c.files[i].Field < c.files[j].Field })
+	return nil
+}
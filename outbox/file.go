@@ -0,0 +1,295 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+)
+
+// DefaultDedupWindow is how long the ids of delivered entries are remembered.
+const DefaultDedupWindow = 24 * time.Hour
+
+// DefaultFailedRetention is how long failed entries are kept.
+const DefaultFailedRetention = 7 * 24 * time.Hour
+
+// compactAfter is how many records the file gets beyond the live ones before
+// it is rewritten.
+const compactAfter = 1024
+
+type record struct {
+	Entry   *Entry    `json:"entry,omitempty"`
+	Done    string    `json:"done,omitempty"`
+	Retried string    `json:"retried,omitempty"`
+	Failed  string    `json:"failed,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// FileStore keeps entries in an append-only file of JSON lines, synced on
+// every write, and rewrites the file once it has grown with delivered ones.
+// Failed entries are dropped by the rewrite once they are older than the
+// retention.
+type FileStore struct {
+	mutex           sync.Mutex
+	path            string
+	file            *os.File
+	pending         []*Entry
+	failed          []*Entry
+	delivered       map[string]time.Time
+	records         int
+	dedupWindow     time.Duration
+	failedRetention time.Duration
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	scope := "outbox.newFileStore"
+
+	f := &FileStore{
+		path:            path,
+		delivered:       make(map[string]time.Time),
+		dedupWindow:     DefaultDedupWindow,
+		failedRetention: DefaultFailedRetention,
+	}
+	if err := f.load(); err != nil {
+		return nil, telecrafterror.Wrap(err).Scope(scope).Input(path).Errorf("error to load the outbox")
+	}
+	if err := f.compact(); err != nil {
+		return nil, telecrafterror.Wrap(err).Scope(scope).Input(path).Errorf("error to compact the outbox")
+	}
+	return f, nil
+}
+
+func (f *FileStore) load() error {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var r record
+		// a torn last line of a crash is skipped
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		f.apply(r)
+	}
+	return scanner.Err()
+}
+
+func (f *FileStore) apply(r record) {
+	switch {
+	case r.Entry != nil && len(r.Failed) > 0:
+		if !f.isKnown(r.Entry.ID) {
+			r.Entry.FailedAt = r.At
+			f.failed = append(f.failed, r.Entry)
+		}
+	case r.Entry != nil:
+		if !f.isKnown(r.Entry.ID) {
+			f.pending = append(f.pending, r.Entry)
+		}
+	case len(r.Done) > 0:
+		f.pending = slices.DeleteFunc(f.pending, func(entry *Entry) bool { return entry.ID == r.Done })
+		f.delivered[r.Done] = r.At
+	case len(r.Retried) > 0:
+		if i := f.indexOf(r.Retried); i >= 0 {
+			f.pending[i].Attempts++
+		}
+	case len(r.Failed) > 0:
+		if i := f.indexOf(r.Failed); i >= 0 {
+			f.pending[i].FailedAt = r.At
+			f.failed = append(f.failed, f.pending[i])
+			f.pending = slices.Delete(f.pending, i, i+1)
+		}
+	}
+}
+
+func (f *FileStore) indexOf(id string) int {
+	return slices.IndexFunc(f.pending, func(entry *Entry) bool { return entry.ID == id })
+}
+
+func (f *FileStore) isKnown(id string) bool {
+	if _, ok := f.delivered[id]; ok {
+		return true
+	}
+	return f.indexOf(id) >= 0 || slices.ContainsFunc(f.failed, func(entry *Entry) bool { return entry.ID == id })
+}
+
+func (f *FileStore) Put(entries ...*Entry) ([]*Entry, error) {
+	scope := "outbox.fileStore.put"
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	added := []*Entry{}
+	records := []record{}
+	for _, entry := range entries {
+		if f.isKnown(entry.ID) || slices.ContainsFunc(added, func(a *Entry) bool { return a.ID == entry.ID }) {
+			continue
+		}
+		added = append(added, entry)
+		records = append(records, record{Entry: entry, At: time.Now()})
+	}
+
+	if err := f.write(records...); err != nil {
+		return nil, telecrafterror.Wrap(err).Scope(scope).Errorf("error to write the outbox")
+	}
+	for _, r := range records {
+		f.apply(r)
+	}
+	return added, nil
+}
+
+func (f *FileStore) Pending() ([]*Entry, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return slices.Clone(f.pending), nil
+}
+
+func (f *FileStore) Done(id string) error {
+	return f.mark(record{Done: id, At: time.Now()}, id)
+}
+
+func (f *FileStore) Retried(id string) error {
+	return f.mark(record{Retried: id, At: time.Now()}, id)
+}
+
+func (f *FileStore) Fail(id string) error {
+	return f.mark(record{Failed: id, At: time.Now()}, id)
+}
+
+func (f *FileStore) Failed() ([]*Entry, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return slices.Clone(f.failed), nil
+}
+
+func (f *FileStore) mark(r record, id string) error {
+	scope := "outbox.fileStore.mark"
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.write(r); err != nil {
+		return telecrafterror.Wrap(err).Scope(scope).Input(id).Errorf("error to write the outbox")
+	}
+	f.apply(r)
+
+	if f.records > f.live()+compactAfter {
+		return f.compact()
+	}
+	return nil
+}
+
+// live is the number of records compact writes.
+func (f *FileStore) live() int {
+	return len(f.pending) + len(f.delivered) + len(f.failed)
+}
+
+// Close closes the file; it is opened again by the next write.
+func (f *FileStore) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *FileStore) write(records ...record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	if f.file == nil {
+		file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		f.file = file
+	}
+
+	data := []byte{}
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	if _, err := f.file.Write(data); err != nil {
+		return err
+	}
+	f.records += len(records)
+	return f.file.Sync()
+}
+
+// compact rewrites the file with the pending entries, the failed ones still
+// inside the retention and the delivered ids still inside the dedup window,
+// then swaps it in.
+func (f *FileStore) compact() error {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+
+	expiration := time.Now().Add(-f.dedupWindow)
+	for id, at := range f.delivered {
+		if at.Before(expiration) {
+			delete(f.delivered, id)
+		}
+	}
+	retention := time.Now().Add(-f.failedRetention)
+	f.failed = slices.DeleteFunc(f.failed, func(entry *Entry) bool { return entry.FailedAt.Before(retention) })
+
+	tmp := f.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	for id, at := range f.delivered {
+		if err := encoder.Encode(record{Done: id, At: at}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	for _, entry := range f.pending {
+		if err := encoder.Encode(record{Entry: entry, At: entry.CreatedAt}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	for _, entry := range f.failed {
+		if err := encoder.Encode(record{Entry: entry, Failed: entry.ID, At: entry.FailedAt}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	f.records = f.live()
+	return os.Rename(tmp, f.path)
+}
@@ -0,0 +1,126 @@
+package outbox
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func entryIDs(entries []*Entry) []string {
+	ids := []string{}
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	f, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+
+	f.Put(
+		&Entry{ID: "1:0", ChatID: 1, Method: "sendMessage", Params: map[string]string{"text": "one"}},
+		&Entry{ID: "1:1", ChatID: 1, Method: "sendPhoto", Files: []File{{Field: "photo", Name: "a.png", Data: []byte{1, 2}}}},
+		&Entry{ID: "2:0", ChatID: 2, Method: "sendMessage"},
+	)
+	f.Done("1:0")
+	added, _ := f.Put(&Entry{ID: "1:0"}, &Entry{ID: "2:0"}, &Entry{ID: "3:0", ChatID: 3}, &Entry{ID: "4:0", ChatID: 4}, &Entry{ID: "3:0"})
+	if ids := entryIDs(added); len(ids) != 2 || ids[0] != "3:0" || ids[1] != "4:0" {
+		t.Errorf("we expected only 3:0 and 4:0 be added but we got %v", ids)
+	}
+	f.Retried("2:0")
+	f.Retried("4:0")
+	f.Fail("4:0")
+	f.Close()
+
+	f, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("we didn't expect error on reopening but we got %v", err)
+	}
+	defer f.Close()
+
+	pending, _ := f.Pending()
+	if ids := entryIDs(pending); len(ids) != 3 || ids[0] != "1:1" || ids[1] != "2:0" || ids[2] != "3:0" {
+		t.Fatalf("we expected 1:1, 2:0 and 3:0 pending but we got %v", ids)
+	}
+	if len(pending[0].Files) != 1 || string(pending[0].Files[0].Data) != string([]byte{1, 2}) {
+		t.Errorf("the files of the entry weren't kept: %+v", pending[0].Files)
+	}
+	if pending[1].Attempts != 1 {
+		t.Errorf("we expected the attempts of 2:0 be kept but we got %d", pending[1].Attempts)
+	}
+	if failed, _ := f.Failed(); len(failed) != 1 || failed[0].ID != "4:0" || failed[0].Attempts != 1 {
+		t.Errorf("we expected 4:0 be failed after reopening but we got %v", entryIDs(failed))
+	}
+
+	f.Put(&Entry{ID: "1:0"}, &Entry{ID: "4:0"})
+	if pending, _ := f.Pending(); len(pending) != 3 {
+		t.Errorf("we expected a delivered id be deduplicated after reopening but we got %v", entryIDs(pending))
+	}
+}
+
+func TestFileStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	f, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+	f.dedupWindow = time.Millisecond
+
+	for i := 0; i < 2*compactAfter; i++ {
+		id := strconv.Itoa(i)
+		f.Put(&Entry{ID: id})
+		f.Done(id)
+	}
+	f.Put(&Entry{ID: "last"})
+	f.Close()
+
+	info, _ := os.Stat(path)
+	if info.Size() > 512*1024 {
+		t.Errorf("we expected the file be compacted but it has %d bytes", info.Size())
+	}
+
+	f, _ = NewFileStore(path)
+	defer f.Close()
+	if pending, _ := f.Pending(); len(pending) != 1 || pending[0].ID != "last" {
+		t.Errorf("we expected only last pending but we got %v", entryIDs(pending))
+	}
+}
+
+func TestFileStoreFailedRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	f, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+	f.Put(&Entry{ID: "old", Files: []File{{Field: "photo", Data: []byte{1}}}}, &Entry{ID: "new"})
+	f.Fail("old")
+	f.failedRetention = 50 * time.Millisecond
+	time.Sleep(100 * time.Millisecond)
+	f.Fail("new")
+
+	if err := f.compact(); err != nil {
+		t.Fatalf("we didn't expect error on compaction but we got %v", err)
+	}
+	f.Close()
+	if failed, _ := f.Failed(); len(failed) != 1 || failed[0].ID != "new" {
+		t.Errorf("we expected only new be kept but we got %v", entryIDs(failed))
+	}
+
+	f, _ = NewFileStore(path)
+	defer f.Close()
+	if failed, _ := f.Failed(); len(failed) != 1 || failed[0].ID != "new" || failed[0].FailedAt.IsZero() {
+		t.Errorf("we expected only new be failed after reopening but we got %v", entryIDs(failed))
+	}
+	if f.records != f.live() {
+		t.Errorf("we expected %d records after reopening but we got %d", f.live(), f.records)
+	}
+}
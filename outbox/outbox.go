@@ -0,0 +1,291 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type File struct {
+	Field string
+	Name  string
+	Data  []byte
+}
+
+// Entry is a request to Telegram waiting to be delivered.
+type Entry struct {
+	ID     string
+	ChatID int64
+	Method string
+	Params map[string]string
+	Files  []File
+	// Fallback is delivered instead when Deliver decides the entry can't be,
+	// e.g. a new message for an edit of a message too old to edit.
+	Fallback *Entry
+	// Screen makes the message delivered the one a single-message UI keeps
+	// editing in the chat.
+	Screen bool
+	// Attempts counts the deliveries which failed and were retried.
+	Attempts  int
+	CreatedAt time.Time
+	// FailedAt is when the entry failed; it is zero while the entry is pending.
+	FailedAt time.Time
+}
+
+// DefaultMaxAttempts is how many times an entry is delivered before it fails.
+const DefaultMaxAttempts = 10
+
+type Store interface {
+	// Put saves entries in order and returns the ones it saved. Entries whose
+	// id was put before, even if it was delivered since, are skipped, so a
+	// redelivered update isn't replied twice.
+	Put(entries ...*Entry) ([]*Entry, error)
+	// Pending returns the undelivered entries in the order they were put.
+	Pending() ([]*Entry, error)
+	// Done marks the entry as delivered.
+	Done(id string) error
+	// Retried counts a failed attempt of the pending entry.
+	Retried(id string) error
+	// Fail moves the pending entry to the failed ones.
+	Fail(id string) error
+	// Failed returns the entries which couldn't be delivered, e.g. to send
+	// them again by hand. Stores may drop them after a while.
+	Failed() ([]*Entry, error)
+	Close() error
+}
+
+// Deliver sends an entry to Telegram. An error wrapped by Retry keeps the
+// entry for a later attempt, until it has been tried MaxAttempts times; any
+// other error fails it.
+type Deliver = func(*Entry) error
+
+type retryError struct {
+	err error
+}
+
+func (e *retryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryError) Unwrap() error {
+	return e.err
+}
+
+// Retry marks an error of Deliver as temporary.
+func Retry(err error) error {
+	return &retryError{err: err}
+}
+
+func isRetry(err error) bool {
+	var e *retryError
+	return errors.As(err, &e)
+}
+
+// Outbox delivers the entries of a store in the background. Entries of one
+// chat are delivered one at a time in order, different chats in parallel.
+// Once an entry of a chat has to be retried, the chat waits retryInterval.
+type Outbox struct {
+	store         Store
+	workers       int
+	retryInterval time.Duration
+	maxAttempts   int
+	mutex         sync.Mutex
+	busy          map[int64]bool
+	retryAt       map[int64]time.Time
+	wake          chan struct{}
+	running       sync.WaitGroup
+}
+
+func New(store Store, workers int, retryInterval time.Duration) *Outbox {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	return &Outbox{
+		store:         store,
+		workers:       workers,
+		retryInterval: retryInterval,
+		maxAttempts:   DefaultMaxAttempts,
+		busy:          make(map[int64]bool),
+		retryAt:       make(map[int64]time.Time),
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// SetMaxAttempts sets how many times an entry is delivered before it fails;
+// it is DefaultMaxAttempts unless changed.
+func (o *Outbox) SetMaxAttempts(maxAttempts int) {
+	o.maxAttempts = maxAttempts
+}
+
+// IsLastAttempt reports whether the entry fails if its delivery fails now,
+// even with an error wrapped by Retry.
+func (o *Outbox) IsLastAttempt(entry *Entry) bool {
+	return entry.Attempts+1 >= o.maxAttempts
+}
+
+// Add saves entries and wakes the sender up. It returns the entries saved,
+// without the ones the store already knew.
+func (o *Outbox) Add(entries ...*Entry) ([]*Entry, error) {
+	added, err := o.store.Put(entries...)
+	if err != nil {
+		return nil, err
+	}
+	o.notify()
+	return added, nil
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers entries until ctx is done, then waits for the deliveries in
+// flight. Whatever is left stays in the store for the next Run.
+func (o *Outbox) Run(ctx context.Context, deliver Deliver) {
+	for {
+		wait := o.schedule(ctx, deliver)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			o.running.Wait()
+			return
+		case <-o.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// schedule starts delivering the chats which have pending entries and are
+// neither busy nor waiting to retry. It returns when it should run again.
+func (o *Outbox) schedule(ctx context.Context, deliver Deliver) time.Duration {
+	wait := time.Minute
+
+	pending, err := o.store.Pending()
+	if err != nil {
+		return o.retryInterval
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	now := time.Now()
+	chats := make(map[int64][]*Entry)
+	order := []int64{}
+	for _, entry := range pending {
+		if _, ok := chats[entry.ChatID]; !ok {
+			order = append(order, entry.ChatID)
+		}
+		chats[entry.ChatID] = append(chats[entry.ChatID], entry)
+	}
+
+	for _, chatID := range order {
+		if o.busy[chatID] {
+			continue
+		}
+		if retryAt, ok := o.retryAt[chatID]; ok && now.Before(retryAt) {
+			wait = min(wait, retryAt.Sub(now))
+			continue
+		}
+		if len(o.busy) >= o.workers {
+			break
+		}
+
+		delete(o.retryAt, chatID)
+		o.busy[chatID] = true
+		o.running.Add(1)
+		go o.deliverChat(ctx, chatID, chats[chatID], deliver)
+	}
+	return wait
+}
+
+func (o *Outbox) deliverChat(ctx context.Context, chatID int64, entries []*Entry, deliver Deliver) {
+	defer o.running.Done()
+	defer o.notify()
+
+	retry := false
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		err := deliver(entry)
+		switch {
+		case err == nil:
+			o.store.Done(entry.ID)
+		case isRetry(err) && !o.IsLastAttempt(entry):
+			o.store.Retried(entry.ID)
+			retry = true
+		default:
+			// a failed entry doesn't hold up the rest of its chat
+			o.store.Fail(entry.ID)
+		}
+		if retry {
+			break
+		}
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	delete(o.busy, chatID)
+	if retry {
+		o.retryAt[chatID] = time.Now().Add(o.retryInterval)
+	}
+}
+
+// Flush waits until every pending entry is delivered, or waits to be retried,
+// or ctx is done. Run must be running.
+func (o *Outbox) Flush(ctx context.Context) error {
+	for {
+		if o.isSettled() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (o *Outbox) isSettled() bool {
+	pending, err := o.store.Pending()
+	if err != nil {
+		return true
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if len(o.busy) > 0 {
+		return false
+	}
+	now := time.Now()
+	for _, entry := range pending {
+		if retryAt, ok := o.retryAt[entry.ChatID]; !ok || !now.Before(retryAt) {
+			return false
+		}
+	}
+	return true
+}
+
+// Pending returns the entries waiting to be delivered, e.g. for monitoring.
+func (o *Outbox) Pending() ([]*Entry, error) {
+	return o.store.Pending()
+}
+
+// Failed returns the entries which couldn't be delivered.
+func (o *Outbox) Failed() ([]*Entry, error) {
+	return o.store.Failed()
+}
+
+func (o *Outbox) Close() error {
+	return o.store.Close()
+}
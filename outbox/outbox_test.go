@@ -0,0 +1,172 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestOutbox(t *testing.T) *Outbox {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "outbox.jsonl"))
+	if err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return New(store, 4, 20*time.Millisecond)
+}
+
+func TestRunKeepsOrderPerChat(t *testing.T) {
+	o := newTestOutbox(t)
+
+	for i := 0; i < 20; i++ {
+		for chatID := int64(1); chatID <= 5; chatID++ {
+			o.Add(&Entry{ID: fmt.Sprintf("%d:%d", chatID, i), ChatID: chatID, Params: map[string]string{"seq": fmt.Sprint(i)}})
+		}
+	}
+
+	var mutex sync.Mutex
+	got := make(map[int64][]string)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx, func(entry *Entry) error {
+			mutex.Lock()
+			got[entry.ChatID] = append(got[entry.ChatID], entry.Params["seq"])
+			mutex.Unlock()
+			return nil
+		})
+		close(done)
+	}()
+
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer flushCancel()
+	if err := o.Flush(flushCtx); err != nil {
+		t.Fatalf("we didn't expect error on flush but we got %v", err)
+	}
+	cancel()
+	<-done
+
+	for chatID := int64(1); chatID <= 5; chatID++ {
+		if len(got[chatID]) != 20 {
+			t.Fatalf("we expected 20 deliveries to %d but we got %d", chatID, len(got[chatID]))
+		}
+		for i, seq := range got[chatID] {
+			if seq != fmt.Sprint(i) {
+				t.Errorf("the entry %s of %d was delivered at %d", seq, chatID, i)
+				break
+			}
+		}
+	}
+	if pending, _ := o.store.Pending(); len(pending) != 0 {
+		t.Errorf("we expected nothing pending but we got %d", len(pending))
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	o := newTestOutbox(t)
+
+	o.Add(
+		&Entry{ID: "a", ChatID: 1},
+		&Entry{ID: "b", ChatID: 1},
+		&Entry{ID: "dropped", ChatID: 2},
+	)
+
+	var mutex sync.Mutex
+	attempts := make(map[string]int)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx, func(entry *Entry) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			attempts[entry.ID]++
+
+			switch {
+			case entry.ID == "a" && attempts["a"] < 3:
+				return Retry(errors.New("too many requests"))
+			case entry.ID == "dropped":
+				return errors.New("bad request")
+			}
+			return nil
+		})
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if pending, _ := o.store.Pending(); len(pending) == 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if attempts["a"] != 3 || attempts["b"] != 1 || attempts["dropped"] != 1 {
+		t.Errorf("we expected a tried 3 times and the others once but we got %v", attempts)
+	}
+	if pending, _ := o.store.Pending(); len(pending) != 0 {
+		t.Errorf("we expected nothing pending but we got %v", entryIDs(pending))
+	}
+	if failed, _ := o.Failed(); len(failed) != 1 || failed[0].ID != "dropped" {
+		t.Errorf("we expected dropped be failed but we got %v", entryIDs(failed))
+	}
+}
+
+func TestRunGivesUp(t *testing.T) {
+	o := newTestOutbox(t)
+	o.retryInterval = time.Millisecond
+	o.SetMaxAttempts(3)
+
+	o.Add(
+		&Entry{ID: "poisoned", ChatID: 1},
+		&Entry{ID: "next", ChatID: 1},
+	)
+
+	var mutex sync.Mutex
+	attempts := make(map[string]int)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx, func(entry *Entry) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			attempts[entry.ID]++
+
+			if entry.ID == "poisoned" {
+				return Retry(errors.New("unreachable"))
+			}
+			return nil
+		})
+		close(done)
+	}()
+
+	// Flush takes a chat waiting to retry as settled, so wait for the failure
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if pending, _ := o.store.Pending(); len(pending) == 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if attempts["poisoned"] != 3 || attempts["next"] != 1 {
+		t.Errorf("we expected poisoned tried 3 times and next once but we got %v", attempts)
+	}
+	if failed, _ := o.Failed(); len(failed) != 1 || failed[0].ID != "poisoned" {
+		t.Errorf("we expected poisoned be failed but we got %v", entryIDs(failed))
+	}
+}
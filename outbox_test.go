@@ -0,0 +1,210 @@
+package telecraft
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/handler"
+	"github.com/mohamadrezamomeni/telecraft/telecrafttest"
+)
+
+func TestCapture(t *testing.T) {
+	for i, testCase := range []struct {
+		chattable tgbotapi.Chattable
+		method    string
+		params    map[string]string
+		files     []string
+	}{
+		{
+			chattable: tgbotapi.NewMessage(1, "hello"),
+			method:    "sendMessage",
+			params:    map[string]string{"chat_id": "1", "text": "hello"},
+		},
+		{
+			chattable: tgbotapi.NewPhoto(2, tgbotapi.FileID("photo-id")),
+			method:    "sendPhoto",
+			params:    map[string]string{"chat_id": "2", "photo": "photo-id"},
+		},
+		{
+			chattable: tgbotapi.NewPhoto(3, tgbotapi.FileBytes{Name: "cover.png", Bytes: []byte("png")}),
+			method:    "sendPhoto",
+			params:    map[string]string{"chat_id": "3"},
+			files:     []string{"photo"},
+		},
+		{
+			chattable: tgbotapi.NewDeleteMessage(4, 10),
+			method:    "deleteMessage",
+			params:    map[string]string{"chat_id": "4", "message_id": "10"},
+		},
+	} {
+		entry, err := capture(testCase.chattable)
+		if err != nil {
+			t.Fatalf("we didn't expect error at %d but we got %v", i, err)
+		}
+
+		if entry.Method != testCase.method {
+			t.Errorf("we expected method %s at %d but we got %s", testCase.method, i, entry.Method)
+		}
+		for key, value := range testCase.params {
+			if entry.Params[key] != value {
+				t.Errorf("we expected %s=%s at %d but we got %s", key, value, i, entry.Params[key])
+			}
+		}
+		if len(entry.Files) != len(testCase.files) {
+			t.Fatalf("we expected files %v at %d but we got %+v", testCase.files, i, entry.Files)
+		}
+		for j, field := range testCase.files {
+			if entry.Files[j].Field != field || len(entry.Files[j].Data) == 0 {
+				t.Errorf("we expected the file %s at %d but we got %+v", field, i, entry.Files[j])
+			}
+		}
+	}
+}
+
+func startUpdate(updateID int, chatID int64) *handler.Context {
+	return handler.NewContext(&tgbotapi.Update{
+		UpdateID: updateID,
+		Message: &tgbotapi.Message{
+			MessageID: updateID,
+			Text:      "/start",
+			From:      &tgbotapi.User{ID: chatID},
+			Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		},
+	})
+}
+
+func TestOutboxSurvivesRestart(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	crashed := newTestBotWithOptions(t, server, &TeleCraftOptions{OutboxPath: path})
+	crashed.handleRequest(startUpdate(7, 1))
+
+	if state, ok := crashed.stateRepo.Get("user:1"); !ok || state.Path != "name" {
+		t.Fatalf("we expected the state be committed but we got %+v", state)
+	}
+	if sent := server.Requests("sendMessage"); len(sent) != 0 {
+		t.Fatalf("we expected nothing sent before serving but we got %d", len(sent))
+	}
+
+	bot := newTestBotWithOptions(t, server, &TeleCraftOptions{OutboxPath: path})
+	served := make(chan error)
+	go func() {
+		served <- bot.Serve(context.Background())
+	}()
+
+	if _, err := server.WaitForRequests("sendMessage", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// the update is redelivered since the offset wasn't confirmed
+	bot.handleRequest(startUpdate(7, 1))
+	bot.handleRequest(startUpdate(8, 2))
+
+	if _, err := server.WaitForRequests("sendMessage", 2, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.Shutdown(context.Background()); err != nil {
+		t.Errorf("we didn't expect error on shutdown but we got %v", err)
+	}
+	<-served
+
+	sent := server.Requests("sendMessage")
+	if len(sent) != 2 || sent[0].ChatID() != 1 || sent[1].ChatID() != 2 {
+		t.Errorf("we expected one reply to each chat but we got %+v", sent)
+	}
+	if pending, _ := bot.outbox.Pending(); len(pending) != 0 {
+		t.Errorf("we expected the outbox be empty but it has %d entries", len(pending))
+	}
+	kept := 0
+	bot.outbox.sends.Range(func(_, _ any) bool {
+		kept++
+		return true
+	})
+	if kept != 0 {
+		t.Errorf("we expected no sends be kept for the redelivered update but we got %d", kept)
+	}
+}
+
+func TestOutboxRetries(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBotWithOptions(t, server, &TeleCraftOptions{
+		OutboxPath:      filepath.Join(t.TempDir(), "outbox.jsonl"),
+		MaxSendAttempts: 1,
+		RetryBackoff:    10 * time.Millisecond,
+	})
+
+	sendErrors := []error{}
+	bot.telecraftOptions.OnSendError = func(_ *handler.Context, _ tgbotapi.Chattable, err error) {
+		sendErrors = append(sendErrors, err)
+	}
+
+	server.Fail("sendMessage", http.StatusBadGateway, "Bad Gateway", 0)
+	server.Fail("sendMessage", http.StatusBadGateway, "Bad Gateway", 0)
+
+	served := make(chan error)
+	go func() {
+		served <- bot.Serve(context.Background())
+	}()
+
+	bot.handleRequest(startUpdate(9, 3))
+
+	requests, err := server.WaitForRequests("sendMessage", 3, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.Shutdown(context.Background())
+	<-served
+
+	if len(requests) != 3 || requests[2].Text() != "what is your name?" {
+		t.Errorf("we expected the reply be retried until it was sent but we got %+v", requests)
+	}
+	if len(sendErrors) != 0 {
+		t.Errorf("we didn't expect retried errors be reported but we got %v", sendErrors)
+	}
+}
+
+func TestOutboxFallsBack(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBotWithOptions(t, server, &TeleCraftOptions{OutboxPath: filepath.Join(t.TempDir(), "outbox.jsonl")})
+	bot.Router.Register("menu", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		msg := tgbotapi.NewMessage(u.ChatID, "menu")
+		return &handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&msg},
+			EditOriginal:   true,
+		}, nil
+	})
+
+	server.Fail("editMessageText", http.StatusBadRequest, "Bad Request: message can't be edited", 0)
+
+	served := make(chan error)
+	go func() {
+		served <- bot.Serve(context.Background())
+	}()
+
+	server.PushCallback(4, 4, 12, "/menu")
+
+	requests, err := server.WaitForRequests("sendMessage", 1, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.Shutdown(context.Background())
+	<-served
+
+	if edits := server.Requests("editMessageText"); len(edits) != 1 || edits[0].Params.Get("message_id") != "12" {
+		t.Errorf("we expected an edit of message 12 but we got %+v", edits)
+	}
+	if requests[0].Text() != "menu" || requests[0].ChatID() != 4 {
+		t.Errorf("we expected the menu be sent instead but we got %+v", requests[0])
+	}
+}
@@ -0,0 +1,74 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Apply logs to the files of logConfig: everything to AccessFile, and
+// warnings and worse to ErrorFile as well. An empty path leaves that output
+// as it is. Closing the returned io.Closer closes the files and logs to
+// stderr again.
+func Apply(logConfig LogConfig) (io.Closer, error) {
+	o := &outputs{}
+
+	if len(logConfig.AccessFile) > 0 {
+		file, err := openLogFile(logConfig.AccessFile)
+		if err != nil {
+			return nil, err
+		}
+		o.files = append(o.files, file)
+		logrus.SetOutput(file)
+	}
+
+	if len(logConfig.ErrorFile) > 0 {
+		file, err := openLogFile(logConfig.ErrorFile)
+		if err != nil {
+			o.Close()
+			return nil, err
+		}
+		o.files = append(o.files, file)
+		logrus.AddHook(&errorHook{writer: file})
+	}
+	return o, nil
+}
+
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
+
+type outputs struct {
+	files []*os.File
+}
+
+func (o *outputs) Close() error {
+	logrus.SetOutput(os.Stderr)
+	logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	errs := []error{}
+	for _, file := range o.files {
+		errs = append(errs, file.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// errorHook writes the entries of the error levels to a writer of their own.
+type errorHook struct {
+	writer io.Writer
+}
+
+func (h *errorHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}
+}
+
+func (h *errorHook) Fire(entry *logrus.Entry) error {
+	line, err := entry.Bytes()
+	if err != nil {
+		return err
+	}
+	_, err = h.writer.Write(line)
+	return err
+}
@@ -1,6 +1,7 @@
 package telecrafterror
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
@@ -19,16 +20,18 @@ const (
 	BadRequest
 	NotFound
 	Duplicate
+	TooManyRequests
 )
 
 type TeleCraftError struct {
-	args      []any
-	pattern   string
-	scope     string
-	err       error
-	isPrinted bool
-	input     []any
-	errorType ErrorType
+	args       []any
+	pattern    string
+	scope      string
+	err        error
+	isPrinted  bool
+	input      []any
+	errorType  ErrorType
+	userFacing bool
 }
 
 func Scope(scope string) *TeleCraftError {
@@ -108,6 +111,18 @@ func (m *TeleCraftError) Duplicate() *TeleCraftError {
 	return m
 }
 
+func (m *TeleCraftError) TooManyRequests() *TeleCraftError {
+	m.errorType = TooManyRequests
+	return m
+}
+
+// UserFacing marks the message of the error as meant for the user of the bot,
+// see UserMessage.
+func (m *TeleCraftError) UserFacing() *TeleCraftError {
+	m.userFacing = true
+	return m
+}
+
 func (m *TeleCraftError) DeactiveWrite() *TeleCraftError {
 	m.isPrinted = false
 	return m
@@ -247,6 +262,22 @@ func (m *TeleCraftError) ErrorWrite() error {
 	return m
 }
 
+func (m *TeleCraftError) Unwrap() error {
+	return m.err
+}
+
+// UserMessage returns the message of the first error marked as UserFacing in
+// the chain of err; the messages wrapping it aren't, as they may carry
+// internal details.
+func UserMessage(err error) (string, bool) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if m, ok := err.(*TeleCraftError); ok && m.userFacing {
+			return m.matchPatternAndArgs(), true
+		}
+	}
+	return "", false
+}
+
 func GetMomoError(err error) (*TeleCraftError, bool) {
 	if err == nil {
 		return nil, false
@@ -71,6 +71,11 @@ func TestErrorType(t *testing.T) {
 	if e.GetErrorType() != BadRequest {
 		t.Error("error type must be BadRequest")
 	}
+
+	e = Wrap(Scope(scope).TooManyRequests())
+	if e.GetErrorType() != TooManyRequests {
+		t.Error("error type must be TooManyRequests")
+	}
 }
 
 func TestMessage(t *testing.T) {
@@ -96,3 +101,24 @@ func TestMessage(t *testing.T) {
 		t.Errorf("message must be %s but we got %s", message, v.Message())
 	}
 }
+
+func TestUserMessage(t *testing.T) {
+	scope := "test.TestUserMessage"
+
+	for i, testCase := range []struct {
+		err      error
+		expected string
+		ok       bool
+	}{
+		{err: Scope(scope).BadRequest().UserFacing().Errorf("send a number"), expected: "send a number", ok: true},
+		{err: Wrap(Scope(scope).BadRequest().UserFacing().Errorf("send a number")).Errorf("the row %d is locked", 5), expected: "send a number", ok: true},
+		{err: Scope(scope).BadRequest().Errorf("the param isn't an integer"), ok: false},
+		{err: fmt.Errorf("wrapped: %w", Scope(scope).UserFacing().Errorf("too long")), expected: "too long", ok: true},
+		{err: nil, ok: false},
+	} {
+		message, ok := UserMessage(testCase.err)
+		if ok != testCase.ok || message != testCase.expected {
+			t.Errorf("we expected %q, %t at %d but we got %q, %t", testCase.expected, testCase.ok, i, message, ok)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package textsplit
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// MaxMessageLength is the limit of Telegram on the text of a message.
+const MaxMessageLength = 4096
+
+type cutKind int
+
+const (
+	cutAnywhere cutKind = iota
+	cutSpace
+	cutLine
+	cutParagraph
+)
+
+// entity is a formatting entity open at some point of the text, with what
+// reopens it in the next chunk and what closes it in this one.
+type entity struct {
+	name  string
+	open  string
+	close string
+}
+
+type cut struct {
+	start  int
+	end    int
+	kind   cutKind
+	stack  []entity
+	length int
+}
+
+// Split breaks text into chunks of at most limit characters, counted in UTF-16
+// units like Telegram does. It prefers paragraph breaks, then line breaks,
+// then spaces, as long as the chunk stays at least half full. With the HTML,
+// Markdown or MarkdownV2 parse mode the entities open at a cut are closed at
+// the end of the chunk and reopened at the start of the next, and tags,
+// escapes and links are never cut.
+func Split(text string, limit int, parseMode string) []string {
+	if limit <= 0 || length(text) <= limit {
+		return []string{text}
+	}
+
+	chunks := []string{}
+	stack := []entity{}
+	pos := 0
+
+	for pos < len(text) {
+		prefix := opening(stack)
+		if rest := closing(scanAll(text, pos, stack, parseMode)); length(prefix+text[pos:]+rest) <= limit {
+			chunks = append(chunks, prefix+text[pos:]+rest)
+			break
+		}
+
+		c := findCut(text, pos, stack, limit-length(prefix), parseMode)
+		chunks = append(chunks, prefix+text[pos:c.start]+closing(c.stack))
+		stack = c.stack
+		pos = c.end
+	}
+	return chunks
+}
+
+// scanAll returns the entities left open at the end of text.
+func scanAll(text string, pos int, stack []entity, parseMode string) []entity {
+	for pos < len(text) {
+		size, next := scanToken(text, pos, stack, parseMode)
+		stack = next
+		pos += size
+	}
+	return stack
+}
+
+// findCut scans text from pos and returns the best cut keeping the chunk
+// within budget together with the closing of its entities.
+func findCut(text string, pos int, stack []entity, budget int, parseMode string) cut {
+	candidates := [cutParagraph + 1]*cut{}
+	used := 0
+	opened := true
+
+	for i := pos; i < len(text); {
+		size, next := scanToken(text, i, stack, parseMode)
+
+		// a chunk neither ends with an empty entity nor starts with one
+		if !opened && len(next) == len(stack) && used+length(closing(stack)) <= budget {
+			kind, end := cutAt(text, i, stack)
+			candidates[kind] = &cut{start: i, end: end, kind: kind, stack: clone(stack), length: used}
+			if kind != cutAnywhere {
+				candidates[cutAnywhere] = candidates[kind]
+			}
+		}
+
+		if used+length(text[i:i+size])+length(closing(next)) > budget && candidates[cutAnywhere] != nil {
+			break
+		}
+		opened = len(next) > len(stack)
+		used += length(text[i : i+size])
+		stack = next
+		i += size
+	}
+
+	for kind := cutParagraph; kind > cutAnywhere; kind-- {
+		if c := candidates[kind]; c != nil && c.length >= budget/2 {
+			return *c
+		}
+	}
+	if c := candidates[cutAnywhere]; c != nil {
+		return *c
+	}
+	// a single token longer than the budget is sent whole
+	size, next := scanToken(text, pos, stack, parseMode)
+	return cut{start: pos + size, end: pos + size, stack: next}
+}
+
+// cutAt tells whether the chunk may end before text[i] and where the next one
+// starts then, skipping the break itself.
+func cutAt(text string, i int, stack []entity) (cutKind, int) {
+	switch {
+	case strings.HasPrefix(text[i:], "\n\n"):
+		end := i
+		for end < len(text) && text[end] == '\n' {
+			end++
+		}
+		return cutParagraph, end
+	case text[i] == '\n':
+		return cutLine, i + 1
+	case text[i] == ' ' && !isCode(stack):
+		return cutSpace, i + 1
+	}
+	return cutAnywhere, i
+}
+
+func isCode(stack []entity) bool {
+	return len(stack) > 0 && (stack[len(stack)-1].name == "pre" || stack[len(stack)-1].name == "code")
+}
+
+// scanToken returns the size of the token at text[i], which is never cut, and
+// the entities open after it.
+func scanToken(text string, i int, stack []entity, parseMode string) (int, []entity) {
+	switch parseMode {
+	case tgbotapi.ModeHTML:
+		return scanHTML(text, i, stack)
+	case tgbotapi.ModeMarkdownV2:
+		return scanMarkdown(text, i, stack, true)
+	case tgbotapi.ModeMarkdown:
+		return scanMarkdown(text, i, stack, false)
+	}
+	_, size := utf8.DecodeRuneInString(text[i:])
+	return size, stack
+}
+
+func scanHTML(text string, i int, stack []entity) (int, []entity) {
+	switch text[i] {
+	case '<':
+		end := strings.IndexByte(text[i:], '>')
+		if end < 0 {
+			break
+		}
+		tag := text[i : i+end+1]
+		if strings.HasPrefix(tag, "</") {
+			return len(tag), closeEntity(stack, tagName(tag[2:]))
+		}
+		name := tagName(tag[1:])
+		return len(tag), append(clone(stack), entity{name: name, open: tag, close: "</" + name + ">"})
+	case '&':
+		if end := strings.IndexByte(text[i:], ';'); end > 0 && end < 10 {
+			return end + 1, stack
+		}
+	}
+	_, size := utf8.DecodeRuneInString(text[i:])
+	return size, stack
+}
+
+func tagName(tag string) string {
+	end := strings.IndexAny(tag, " \t\n>")
+	if end < 0 {
+		return strings.ToLower(tag)
+	}
+	return strings.ToLower(tag[:end])
+}
+
+func scanMarkdown(text string, i int, stack []entity, v2 bool) (int, []entity) {
+	rest := text[i:]
+	inCode := isCode(stack)
+
+	switch {
+	case rest[0] == '\\' && len(rest) > 1 && (v2 || !inCode):
+		_, size := utf8.DecodeRuneInString(rest[1:])
+		return 1 + size, stack
+	case strings.HasPrefix(rest, "```"):
+		if inCode {
+			return 3, closeEntity(stack, "pre")
+		}
+		open := "```"
+		if line := strings.IndexByte(rest, '\n'); line >= 0 && !strings.ContainsAny(rest[3:line], " `") {
+			open = rest[:line+1]
+		}
+		return len(open), append(clone(stack), entity{name: "pre", open: open, close: "```"})
+	case rest[0] == '`':
+		return 1, toggle(stack, "code", "`")
+	case inCode:
+	case rest[0] == '[':
+		if size := linkSize(rest); size > 0 {
+			return size, stack
+		}
+	case v2 && strings.HasPrefix(rest, "||"):
+		return 2, toggle(stack, "spoiler", "||")
+	case v2 && strings.HasPrefix(rest, "__"):
+		return 2, toggle(stack, "underline", "__")
+	case rest[0] == '*':
+		return 1, toggle(stack, "bold", "*")
+	case rest[0] == '_':
+		return 1, toggle(stack, "italic", "_")
+	case v2 && rest[0] == '~':
+		return 1, toggle(stack, "strike", "~")
+	}
+	_, size := utf8.DecodeRuneInString(rest)
+	return size, stack
+}
+
+// linkSize is the size of the link [text](url) at the start of text, or zero.
+func linkSize(text string) int {
+	middle := strings.Index(text, "](")
+	if middle < 0 || strings.IndexByte(text[:middle], '\n') >= 0 {
+		return 0
+	}
+	end := strings.IndexByte(text[middle:], ')')
+	if end < 0 {
+		return 0
+	}
+	return middle + end + 1
+}
+
+func toggle(stack []entity, name string, marker string) []entity {
+	for _, e := range stack {
+		if e.name == name {
+			return closeEntity(stack, name)
+		}
+	}
+	return append(clone(stack), entity{name: name, open: marker, close: marker})
+}
+
+// closeEntity drops the innermost entity called name and everything opened
+// inside it.
+func closeEntity(stack []entity, name string) []entity {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].name == name {
+			return clone(stack[:i])
+		}
+	}
+	return stack
+}
+
+func clone(stack []entity) []entity {
+	return append([]entity{}, stack...)
+}
+
+func opening(stack []entity) string {
+	var b strings.Builder
+	for _, e := range stack {
+		b.WriteString(e.open)
+	}
+	return b.String()
+}
+
+func closing(stack []entity) string {
+	var b strings.Builder
+	for i := len(stack) - 1; i >= 0; i-- {
+		b.WriteString(stack[i].close)
+	}
+	return b.String()
+}
+
+func length(text string) int {
+	n := 0
+	for _, r := range text {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
@@ -0,0 +1,102 @@
+package textsplit
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestSplit(t *testing.T) {
+	for i, testCase := range []struct {
+		text      string
+		limit     int
+		parseMode string
+		expected  []string
+	}{
+		{
+			text:     "short",
+			limit:    10,
+			expected: []string{"short"},
+		},
+		{
+			text:     "first paragraph\n\nsecond one",
+			limit:    20,
+			expected: []string{"first paragraph", "second one"},
+		},
+		{
+			text:     "line one\nline two\nline three",
+			limit:    20,
+			expected: []string{"line one\nline two", "line three"},
+		},
+		{
+			text:     "a\n\nbbbbbbbbbbbb ccccc",
+			limit:    16,
+			expected: []string{"a\n\nbbbbbbbbbbbb", "ccccc"},
+		},
+		{
+			text:     "abcdefghij",
+			limit:    4,
+			expected: []string{"abcd", "efgh", "ij"},
+		},
+		{
+			text:     "😀😀😀",
+			limit:    4,
+			expected: []string{"😀😀", "😀"},
+		},
+		{
+			text:      "<b>bold words here</b>",
+			limit:     14,
+			parseMode: tgbotapi.ModeHTML,
+			expected:  []string{"<b>bold</b>", "<b>words</b>", "<b>here</b>"},
+		},
+		{
+			text:      `<a href="x">link text</a> &amp; more`,
+			limit:     20,
+			parseMode: tgbotapi.ModeHTML,
+			expected:  []string{`<a href="x">link</a>`, `<a href="x">text</a>`, "&amp; more"},
+		},
+		{
+			text:      "*bold words* and _more_",
+			limit:     10,
+			parseMode: tgbotapi.ModeMarkdownV2,
+			expected:  []string{"*bold*", "*words*", "and _more_"},
+		},
+		{
+			text:      "```go\nline one\nline two\n```",
+			limit:     20,
+			parseMode: tgbotapi.ModeMarkdownV2,
+			expected:  []string{"```go\nline one```", "```go\nline two\n```"},
+		},
+		{
+			text:      "text \\* [a link](http://x.y)",
+			limit:     12,
+			parseMode: tgbotapi.ModeMarkdownV2,
+			expected:  []string{"text \\*", "[a link](http://x.y)"},
+		},
+	} {
+		chunks := Split(testCase.text, testCase.limit, testCase.parseMode)
+
+		if strings.Join(chunks, "|") != strings.Join(testCase.expected, "|") {
+			t.Errorf("we expected %q but we got %q at %d", testCase.expected, chunks, i)
+		}
+	}
+}
+
+func TestSplitKeepsLimit(t *testing.T) {
+	paragraph := strings.Repeat("<i>word</i> ", 100)
+	text := strings.Repeat(paragraph+"\n\n", 20)
+
+	chunks := Split(text, MaxMessageLength, tgbotapi.ModeHTML)
+	if len(chunks) < 2 {
+		t.Fatalf("we expected several chunks but we got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if length(chunk) > MaxMessageLength {
+			t.Errorf("we expected at most %d characters but we got %d at %d", MaxMessageLength, length(chunk), i)
+		}
+		if strings.Count(chunk, "<i>") != strings.Count(chunk, "</i>") {
+			t.Errorf("we expected balanced tags but we got %q at %d", chunk, i)
+		}
+	}
+}
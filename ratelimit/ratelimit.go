@@ -0,0 +1,213 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+)
+
+// maxIdleBuckets is how many chat buckets are kept before the full ones, which
+// behave like new buckets, are dropped.
+const maxIdleBuckets = 1024
+
+// Limit allows Count sends every Interval, in bursts of up to Count. A zero
+// Limit is unlimited.
+type Limit struct {
+	Count    int
+	Interval time.Duration
+}
+
+func (l Limit) isUnlimited() bool {
+	return l.Count <= 0 || l.Interval <= 0
+}
+
+// Every is a shorthand for Limit{Count: count, Interval: interval}.
+func Every(count int, interval time.Duration) Limit {
+	return Limit{Count: count, Interval: interval}
+}
+
+// ParseLimit reads a limit like "30/1s", "20/1m" or "1/s"; an empty string is
+// unlimited.
+func ParseLimit(text string) (Limit, error) {
+	scope := "ratelimit.parseLimit"
+
+	if len(text) == 0 {
+		return Limit{}, nil
+	}
+
+	count, interval, ok := strings.Cut(text, "/")
+	if !ok {
+		return Limit{}, telecrafterror.Scope(scope).BadRequest().Input(text).Errorf("the limit must look like count/interval")
+	}
+
+	c, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || c < 0 {
+		return Limit{}, telecrafterror.Scope(scope).BadRequest().Input(text).Errorf("the count of the limit is invalid")
+	}
+
+	interval = strings.TrimSpace(interval)
+	if len(interval) > 0 && (interval[0] < '0' || interval[0] > '9') {
+		interval = "1" + interval
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil || d < 0 {
+		return Limit{}, telecrafterror.Scope(scope).BadRequest().Input(text).Errorf("the interval of the limit is invalid")
+	}
+
+	return Every(c, d), nil
+}
+
+// Limits are the outgoing limits of a bot. Chat applies to private chats and
+// Group to chats with a negative id, i.e. groups and channels.
+type Limits struct {
+	Global Limit
+	Chat   Limit
+	Group  Limit
+}
+
+// TelegramLimits are the limits Telegram documents for bots: about 30
+// messages a second overall, one a second in a chat and 20 a minute in a group.
+func TelegramLimits() Limits {
+	return Limits{
+		Global: Every(30, time.Second),
+		Chat:   Every(1, time.Second),
+		Group:  Every(20, time.Minute),
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// reserve takes a token, going into debt when there is none, and returns
+// how long to wait until the debt is paid. Later reservations queue behind
+// earlier ones, so waits keep the order of the reservations.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(b.limit.Interval) / float64(b.limit.Count))
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(elapsed) * float64(b.limit.Count) / float64(b.limit.Interval)
+		b.last = now
+	}
+	if burst := float64(b.limit.Count); b.tokens > burst {
+		b.tokens = burst
+	}
+}
+
+func (b *bucket) isFull(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= float64(b.limit.Count)
+}
+
+func newBucket(limit Limit, now time.Time) *bucket {
+	return &bucket{tokens: float64(limit.Count), last: now, limit: limit}
+}
+
+// Limiter is a token bucket scheduler for outgoing requests, one bucket for
+// the bot and one for every chat.
+type Limiter struct {
+	mutex  sync.Mutex
+	limits Limits
+	global *bucket
+	chats  map[int64]*bucket
+}
+
+func New(limits Limits) *Limiter {
+	l := &Limiter{
+		limits: limits,
+		chats:  make(map[int64]*bucket),
+	}
+	if !limits.Global.isUnlimited() {
+		l.global = newBucket(limits.Global, time.Now())
+	}
+	return l
+}
+
+// reserveChat books a send to chatID in the bucket of its chat and returns
+// how long to wait before it. A chatID of zero has no chat bucket.
+func (l *Limiter) reserveChat(chatID int64, now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if chat := l.chatBucket(chatID, now); chat != nil {
+		return chat.reserve(now)
+	}
+	return 0
+}
+
+// reserveGlobal books the send in the bucket of the bot. It is only called
+// for sends due now, since a bucket refilled up to a later time would lend
+// the tokens of that time to every other chat.
+func (l *Limiter) reserveGlobal(now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.global == nil {
+		return 0
+	}
+	return l.global.reserve(now)
+}
+
+// Wait blocks until a send to chatID is allowed or ctx is done. It waits for
+// the chat first and takes the global token once the chat allows the send.
+func (l *Limiter) Wait(ctx context.Context, chatID int64) error {
+	if err := sleep(ctx, l.reserveChat(chatID, time.Now())); err != nil {
+		return err
+	}
+	return sleep(ctx, l.reserveGlobal(time.Now()))
+}
+
+func sleep(ctx context.Context, wait time.Duration) error {
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) chatBucket(chatID int64, now time.Time) *bucket {
+	limit := l.limits.Chat
+	if chatID < 0 {
+		limit = l.limits.Group
+	}
+	if chatID == 0 || limit.isUnlimited() {
+		return nil
+	}
+
+	if b, ok := l.chats[chatID]; ok {
+		return b
+	}
+
+	if len(l.chats) >= maxIdleBuckets {
+		for id, b := range l.chats {
+			if b.isFull(now) {
+				delete(l.chats, id)
+			}
+		}
+	}
+
+	b := newBucket(limit, now)
+	l.chats[chatID] = b
+	return b
+}
@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	for i, testCase := range []struct {
+		text        string
+		expected    Limit
+		expectError bool
+	}{
+		{text: "30/1s", expected: Every(30, time.Second)},
+		{text: "20/m", expected: Every(20, time.Minute)},
+		{text: "5 / 500ms", expected: Every(5, 500*time.Millisecond)},
+		{text: "", expected: Limit{}},
+		{text: "30", expectError: true},
+		{text: "x/1s", expectError: true},
+		{text: "30/soon", expectError: true},
+	} {
+		limit, err := ParseLimit(testCase.text)
+		if testCase.expectError && err == nil {
+			t.Errorf("we expected an error at %d but we got nothing", i)
+		}
+		if !testCase.expectError && (err != nil || limit != testCase.expected) {
+			t.Errorf("we expected %+v at %d but we got %+v, %v", testCase.expected, i, limit, err)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	for i, testCase := range []struct {
+		limits   Limits
+		chatIDs  []int64
+		expected []time.Duration
+	}{
+		{
+			limits:   Limits{Chat: Every(1, time.Second)},
+			chatIDs:  []int64{1, 1, 1, 2},
+			expected: []time.Duration{0, time.Second, 2 * time.Second, 0},
+		},
+		{
+			limits:   Limits{Chat: Every(1, time.Second), Group: Every(2, time.Minute)},
+			chatIDs:  []int64{-1, -1, -1},
+			expected: []time.Duration{0, 0, 30 * time.Second},
+		},
+		{
+			limits:   Limits{Global: Every(2, time.Second)},
+			chatIDs:  []int64{1, 2, 3, 0},
+			expected: []time.Duration{0, 0, 500 * time.Millisecond, time.Second},
+		},
+		{
+			limits:   Limits{Global: Every(10, time.Second), Chat: Every(1, time.Second)},
+			chatIDs:  []int64{1, 1},
+			expected: []time.Duration{0, time.Second},
+		},
+		{
+			limits:   Limits{},
+			chatIDs:  []int64{1, 1, 1},
+			expected: []time.Duration{0, 0, 0},
+		},
+	} {
+		l := New(testCase.limits)
+		now := time.Now()
+		for j, chatID := range testCase.chatIDs {
+			wait := l.reserveChat(chatID, now)
+			if wait == 0 {
+				wait = l.reserveGlobal(now)
+			}
+			if diff := wait - testCase.expected[j]; diff < -10*time.Millisecond || diff > 10*time.Millisecond {
+				t.Errorf("we expected a wait of %s at %d.%d but we got %s", testCase.expected[j], i, j, wait)
+			}
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	l := New(Limits{Chat: Every(1, 50*time.Millisecond)})
+
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background(), 1); err != nil {
+			t.Fatalf("we didn't expect error but we got %v", err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 100*time.Millisecond {
+		t.Errorf("we expected the sends be spread over 100ms but they took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.reserveChat(1, time.Now())
+	if err := l.Wait(ctx, 1); err == nil {
+		t.Error("we expected an error when ctx is done")
+	}
+}
+
+func TestWaitKeepsGlobalRate(t *testing.T) {
+	interval := 10 * time.Millisecond
+	l := New(Limits{Global: Every(10, 10*interval), Chat: Every(1, interval)})
+	started := time.Now()
+
+	var (
+		mutex sync.Mutex
+		sent  []time.Duration
+		wg    sync.WaitGroup
+	)
+	send := func(chatID int64) {
+		defer wg.Done()
+		if err := l.Wait(context.Background(), chatID); err != nil {
+			t.Errorf("we didn't expect error but we got %v", err)
+		}
+		mutex.Lock()
+		sent = append(sent, time.Since(started))
+		mutex.Unlock()
+	}
+
+	// 10 sends take the burst, then a backed up chat and 9 fresh chats
+	// have to share one token every interval
+	chatIDs := []int64{}
+	for i := 0; i < 10; i++ {
+		chatIDs = append(chatIDs, int64(100+i))
+	}
+	for i := 0; i < 20; i++ {
+		chatIDs = append(chatIDs, 1)
+	}
+	for i := 0; i < 9; i++ {
+		chatIDs = append(chatIDs, int64(200+i))
+	}
+	for _, chatID := range chatIDs {
+		wg.Add(1)
+		go send(chatID)
+	}
+	wg.Wait()
+
+	slices.Sort(sent)
+	for i, elapsed := range sent {
+		if earliest := time.Duration(i-9) * interval; elapsed < earliest {
+			t.Fatalf("we expected the send %d not before %s but we got %s", i, earliest, elapsed)
+		}
+	}
+}
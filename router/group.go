@@ -0,0 +1,57 @@
+package router
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mohamadrezamomeni/telecraft/handler"
+)
+
+// Group registers routes under a shared prefix, wrapped by shared
+// middlewares. Groups nest; the middlewares of outer groups run first, then
+// the ones of inner groups and last the ones of the route.
+type Group struct {
+	router      *Router
+	prefix      string
+	middlewares []handler.Middleware
+}
+
+// Group returns a group whose routes are registered under prefix and wrapped
+// by ms.
+func (r *Router) Group(prefix string, ms ...handler.Middleware) *Group {
+	return &Group{
+		router:      r,
+		prefix:      strings.Trim(prefix, "/"),
+		middlewares: slices.Clone(ms),
+	}
+}
+
+// Group returns a group nested in g.
+func (g *Group) Group(prefix string, ms ...handler.Middleware) *Group {
+	return &Group{
+		router:      g.router,
+		prefix:      g.join(prefix),
+		middlewares: slices.Concat(g.middlewares, ms),
+	}
+}
+
+// Register registers h under the prefix of the group; an empty path
+// registers the prefix itself.
+func (g *Group) Register(
+	path string,
+	h handler.HandlerFunc,
+	ms ...handler.Middleware,
+) *Route {
+	return g.router.Register(g.join(path), h, slices.Concat(g.middlewares, ms)...)
+}
+
+func (g *Group) join(path string) string {
+	path = strings.Trim(path, "/")
+	switch {
+	case len(g.prefix) == 0:
+		return path
+	case len(path) == 0:
+		return g.prefix
+	}
+	return g.prefix + "/" + path
+}
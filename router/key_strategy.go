@@ -0,0 +1,45 @@
+package router
+
+import (
+	"strconv"
+
+	"github.com/mohamadrezamomeni/telecraft/handler"
+)
+
+// KeyStrategy derives the key of the state repository from a context. An empty
+// key means the update has no state.
+type KeyStrategy = func(*handler.Context) string
+
+func KeyByUser(context *handler.Context) string {
+	if len(context.UserID) == 0 {
+		return ""
+	}
+	return "user:" + context.UserID
+}
+
+func KeyByChat(context *handler.Context) string {
+	if !context.HasChat() {
+		return ""
+	}
+	return "chat:" + strconv.FormatInt(context.ChatID, 10)
+}
+
+func KeyByUserInChat(context *handler.Context) string {
+	if len(context.UserID) == 0 {
+		return ""
+	}
+	if !context.HasChat() {
+		return KeyByUser(context)
+	}
+	return KeyByChat(context) + ":user:" + context.UserID
+}
+
+func KeyByTopic(context *handler.Context) string {
+	if context.MessageThreadID == 0 {
+		return KeyByUserInChat(context)
+	}
+	if len(context.UserID) == 0 || !context.HasChat() {
+		return ""
+	}
+	return KeyByChat(context) + ":topic:" + strconv.Itoa(context.MessageThreadID) + ":user:" + context.UserID
+}
@@ -1,6 +1,8 @@
 package router
 
 import (
+	"net/url"
+	"slices"
 	"strings"
 	"time"
 
@@ -17,17 +19,35 @@ type StateRepository interface {
 }
 
 type Router struct {
-	data              *tree.Tree
-	defaultRoute      string
-	globalMiddlewares []handler.Middleware
-	stateRepo         StateRepository
+	data               *tree.Tree
+	defaultRoute       string
+	globalMiddlewares  []handler.Middleware
+	stateRepo          StateRepository
+	keyStrategy        KeyStrategy
+	stateTTL           time.Duration
+	routeKeyStrategies map[*tree.Tree]KeyStrategy
+	lookupStrategies   []KeyStrategy
+	commitHook         CommitHook
+}
+
+// CommitHook runs after a handler has responded and before its state is
+// saved. When it fails the state is left as it was and Route returns no
+// response.
+type CommitHook = func(*handler.Context, *handler.ResponseHandlerFunc) error
+
+type Route struct {
+	router *Router
+	node   *tree.Tree
 }
 
 func New(defaultRoute string, stateRepo StateRepository) *Router {
 	return &Router{
-		data:         tree.New("", nil),
-		defaultRoute: defaultRoute,
-		stateRepo:    stateRepo,
+		data:               tree.New("", nil),
+		defaultRoute:       defaultRoute,
+		stateRepo:          stateRepo,
+		keyStrategy:        KeyByUser,
+		stateTTL:           2 * time.Minute,
+		routeKeyStrategies: make(map[*tree.Tree]KeyStrategy),
 	}
 }
 
@@ -35,17 +55,43 @@ func (r *Router) Register(
 	path string,
 	h handler.HandlerFunc,
 	ms ...handler.Middleware,
-) {
+) *Route {
 	finalHandler := handler.ApplyMiddlewares(h, ms...)
 
 	if r.globalMiddlewares != nil && len(r.globalMiddlewares) > 0 {
 		finalHandler = handler.ApplyMiddlewares(finalHandler, r.globalMiddlewares...)
 	}
 
-	r.data.Set(
+	node := r.data.Set(
 		r.makeHierarchyPath(path),
 		finalHandler,
 	)
+
+	return &Route{
+		router: r,
+		node:   node,
+	}
+}
+
+// WithKeyStrategy scopes the state pointing to this route by the given
+// strategy instead of the one of the router.
+func (route *Route) WithKeyStrategy(keyStrategy KeyStrategy) *Route {
+	route.router.routeKeyStrategies[route.node] = keyStrategy
+	route.router.lookupStrategies = append(route.router.lookupStrategies, keyStrategy)
+	return route
+}
+
+func (r *Router) SetStateTTL(ttl time.Duration) {
+	r.stateTTL = ttl
+}
+
+// SetKeyStrategy sets how states are keyed by default; it is KeyByUser unless changed.
+func (r *Router) SetKeyStrategy(keyStrategy KeyStrategy) {
+	r.keyStrategy = keyStrategy
+}
+
+func (r *Router) SetCommitHook(commitHook CommitHook) {
+	r.commitHook = commitHook
 }
 
 func (r *Router) makeHierarchyPath(path string) []string {
@@ -57,104 +103,192 @@ func (r *Router) SetGlobalMiddlewares(middlewwares ...handler.Middleware) {
 }
 
 func (r *Router) Route(context *handler.Context) (*handler.ResponseHandlerFunc, error) {
+	scope := "telegram.router.route"
+
 	var res *handler.ResponseHandlerFunc
+	var stateKey string
 	var err error
 
 	switch {
 	case context.CallbackQuery != nil:
-		res, err = r.callbackQuery(context)
+		res, stateKey, err = r.callbackQuery(context)
 	case context.Message != nil:
-		res, err = r.message(context)
+		res, stateKey, err = r.message(context)
 	}
 
 	if res == nil {
 		res, _ = r.RootHandler(context)
 	}
 
+	if res != nil && r.commitHook != nil {
+		if commitErr := r.commitHook(context, res); commitErr != nil {
+			return nil, telecrafterror.Wrap(commitErr).Scope(scope).Input(context.UserID).Errorf("the response couldn't be committed")
+		}
+	}
+
 	if res != nil && res.ReleaseState {
-		r.stateRepo.Delete(context.UserID)
+		r.deleteState(stateKey, r.keyStrategy(context))
 	} else if res != nil && (len(res.Path) > 0 || len(res.Data) > 0) {
-		r.stateRepo.Set(context.UserID, &state.State{
-			Data:       res.Data,
-			Path:       res.Path,
-			Expiration: time.Now().Add(2 * 60 * time.Second),
-		})
+		key := r.stateKey(res.Path, context)
+		if stateKey != key {
+			r.deleteState(stateKey)
+		}
+		if len(key) > 0 {
+			r.stateRepo.Set(key, &state.State{
+				Data:       res.Data,
+				Path:       res.Path,
+				Expiration: time.Now().Add(r.stateTTL),
+			})
+		}
 	}
 	return res, err
 }
 
-func (r *Router) callbackQuery(context *handler.Context) (*handler.ResponseHandlerFunc, error) {
+func (r *Router) deleteState(keys ...string) {
+	for _, key := range keys {
+		if len(key) > 0 {
+			r.stateRepo.Delete(key)
+		}
+	}
+}
+
+// stateKey returns the key of the state which points to path.
+func (r *Router) stateKey(path string, context *handler.Context) string {
+	path, _ = splitQuery(path)
+	if node, _ := r.data.MatchPath(r.makeHierarchyPath(path)); node != nil {
+		if keyStrategy, ok := r.routeKeyStrategies[node]; ok {
+			return keyStrategy(context)
+		}
+	}
+	return r.keyStrategy(context)
+}
+
+func (r *Router) callbackQuery(context *handler.Context) (*handler.ResponseHandlerFunc, string, error) {
 	text := context.CallbackQuery.Data
 	return r.getResponse(text, context)
 }
 
-func (r *Router) message(context *handler.Context) (*handler.ResponseHandlerFunc, error) {
+func (r *Router) message(context *handler.Context) (*handler.ResponseHandlerFunc, string, error) {
 	text := context.Message.Text
 	return r.getResponse(text, context)
 }
 
-func (r *Router) getResponse(text string, context *handler.Context) (*handler.ResponseHandlerFunc, error) {
+func (r *Router) getResponse(text string, context *handler.Context) (*handler.ResponseHandlerFunc, string, error) {
 	var res *handler.ResponseHandlerFunc
+	var stateKey string
 	var err error
-	if err != nil {
-		return nil, err
-	}
 
 	if r.isPath(text) {
-		r.stateRepo.Delete(context.UserID)
-		path := r.getPathFromText(text)
+		r.deleteState(r.stateKeys(context)...)
+		path, args := r.getPathFromText(text)
+		context.Args = args
 		res, err = r.routeFromText(path, context)
 	}
 
 	if res == nil && err == nil {
-		res, err = r.getResponseFromState(context)
+		res, stateKey, err = r.getResponseFromState(context)
 	}
 
-	return res, err
+	return res, stateKey, err
 }
 
-func (r *Router) getResponseFromState(context *handler.Context) (*handler.ResponseHandlerFunc, error) {
+// getResponseFromState looks the state up by the key strategy of the router
+// first and then by the ones of the routes.
+func (r *Router) getResponseFromState(context *handler.Context) (*handler.ResponseHandlerFunc, string, error) {
 	scope := "telegram.router.getResponseFromState"
 
-	state, isExist := r.stateRepo.Get(context.UserID)
+	state, key, isExist := r.findState(context)
 	if !isExist {
-		return nil, telecrafterror.Scope(scope).ErrorWrite()
+		telecrafterror.Scope(scope).DeactiveWrite().DebuggingErrorf("there is no state, the root handler takes it")
+		return nil, "", nil
 	}
 
-	handler, params := r.getHandlerWithParam(state.Path)
+	path, query := splitQuery(state.Path)
+	handler, params := r.getHandlerWithParam(path)
+
+	context.Query = query
 
 	context.Params = params
+	if len(state.Data) > 0 && context.Data == nil {
+		context.Data = make(map[string]any, len(state.Data))
+	}
+	for key, value := range state.Data {
+		context.Data[key] = value
+	}
 
 	res, err := handler(context)
 	if err != nil {
-		res, _ := r.RootHandler(context)
-		return res, err
+		return r.onHandlerError(context, err), key, err
 	}
 
-	return res, nil
+	return res, key, nil
+}
+
+func (r *Router) findState(context *handler.Context) (*state.State, string, bool) {
+	for _, key := range r.stateKeys(context) {
+		if state, isExist := r.stateRepo.Get(key); isExist {
+			return state, key, true
+		}
+	}
+	return nil, "", false
+}
+
+// stateKeys returns the keys a state of context may be stored under, the one
+// of the router first and then the ones of the routes.
+func (r *Router) stateKeys(context *handler.Context) []string {
+	keys := []string{}
+	for _, keyStrategy := range append([]KeyStrategy{r.keyStrategy}, r.lookupStrategies...) {
+		if key := keyStrategy(context); len(key) > 0 && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
 }
 
-func (r *Router) getPathFromText(path string) string {
-	return path[1:]
+// getPathFromText returns the path of a text starting with / and the words
+// after it, like search and [harry potter] of /search harry potter.
+func (r *Router) getPathFromText(text string) (string, []string) {
+	fields := strings.Fields(text[1:])
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
 }
 
 func (r *Router) routeFromText(path string, context *handler.Context) (*handler.ResponseHandlerFunc, error) {
+	path, context.Query = splitQuery(path)
 	handler, params := r.getHandlerWithParam(path)
 
 	r.enrichContext(context, params)
 
 	res, err := handler(context)
 	if err != nil {
-		res, _ = r.RootHandler(context)
-		return res, err
+		return r.onHandlerError(context, err), err
 	}
 	return res, nil
 }
 
+// onHandlerError is the response to a failed handler: the one of the root
+// handler, or an empty one for an error marked as UserFacing, which keeps the
+// state so the user can send again what was rejected.
+func (r *Router) onHandlerError(context *handler.Context, err error) *handler.ResponseHandlerFunc {
+	if _, ok := telecrafterror.UserMessage(err); ok {
+		return &handler.ResponseHandlerFunc{}
+	}
+	res, _ := r.RootHandler(context)
+	return res
+}
+
 func (r *Router) RootHandler(context *handler.Context) (*handler.ResponseHandlerFunc, error) {
-	handler, params := r.getHandlerWithParam(r.defaultRoute)
+	scope := "telegram.router.rootHandler"
+
+	node, params := r.data.MatchPath(r.makeHierarchyPath(r.defaultRoute))
+	if node == nil {
+		return nil, telecrafterror.Scope(scope).NotFound().Input(r.defaultRoute).Errorf("the default route isn't registered")
+	}
+
 	r.enrichContext(context, params)
-	res, err := handler(context)
+	res, err := node.Handler(context)
 	return res, err
 }
 
@@ -170,10 +304,20 @@ func (r *Router) enrichContext(context *handler.Context, params map[string]strin
 	context.Params = params
 }
 
+// splitQuery separates the query of a path, like page=2 of books?page=2.
+func splitQuery(path string) (string, url.Values) {
+	path, rawQuery, found := strings.Cut(path, "?")
+	if !found {
+		return path, nil
+	}
+	query, _ := url.ParseQuery(rawQuery)
+	return path, query
+}
+
 func (r *Router) isPath(text string) bool {
 	action := byte('/')
 
-	if text[0] == action {
+	if len(text) > 0 && text[0] == action {
 		return true
 	}
 
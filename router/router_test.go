@@ -3,6 +3,8 @@ package router
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -361,3 +363,264 @@ func testSequentialRequests(t *testing.T, requests []struct {
 		}
 	}
 }
+
+func TestKeyStrategies(t *testing.T) {
+	repo, err := state.NewRepository("cache")
+	if err != nil {
+		t.Fatalf("failed to create cache state: %v", err)
+	}
+
+	r := New("root", repo)
+	r.SetKeyStrategy(KeyByUserInChat)
+
+	reply := func(text string) *handler.ResponseHandlerFunc {
+		return &handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{{Text: text}},
+		}
+	}
+
+	r.Register("root", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		return reply("root"), nil
+	})
+	r.Register("name", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		if u.Message.Text == "/name" {
+			res := reply("what is your name?")
+			res.Path = "name"
+			return res, nil
+		}
+		res := reply("hello " + u.Message.Text)
+		res.ReleaseState = true
+		return res, nil
+	})
+	r.Register("vote", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		res := reply("vote of " + u.UserID + " is " + u.Message.Text)
+		res.Path = "vote"
+		return res, nil
+	}).WithKeyStrategy(KeyByChat)
+
+	message := func(userID string, chatID int64, text string) *handler.Context {
+		return &handler.Context{
+			UserID: userID,
+			ChatID: chatID,
+			Update: &tgbotapi.Update{
+				Message: &tgbotapi.Message{Text: text},
+			},
+		}
+	}
+
+	for i, testCase := range []struct {
+		input    *handler.Context
+		expected string
+	}{
+		{input: message("1", -10, "/name"), expected: "what is your name?"},
+		{input: message("1", -20, "mic"), expected: "root"},
+		{input: message("2", -10, "mic"), expected: "root"},
+		{input: message("1", -10, "mic"), expected: "hello mic"},
+		{input: message("1", -10, "mic"), expected: "root"},
+		{input: message("1", -30, "/vote"), expected: "vote of 1 is /vote"},
+		{input: message("2", -30, "yes"), expected: "vote of 2 is yes"},
+		{input: message("3", -30, "no"), expected: "vote of 3 is no"},
+		{input: message("3", -40, "no"), expected: "root"},
+		{input: message("3", -30, "/root"), expected: "root"},
+		{input: message("2", -30, "maybe"), expected: "root"},
+	} {
+		res, _ := r.Route(testCase.input)
+		if !isErrorConfigsMatched([]*tgbotapi.MessageConfig{{Text: testCase.expected}}, res.MessageConfigs) {
+			t.Errorf("we expected %s at %d but we got %v", testCase.expected, i, res.MessageConfigs[0].Text)
+		}
+	}
+}
+
+func TestCommitHook(t *testing.T) {
+	repo, err := state.NewRepository("cache")
+	if err != nil {
+		t.Fatalf("failed to create cache state: %v", err)
+	}
+
+	r := New("root", repo)
+	r.Register("root", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		return &handler.ResponseHandlerFunc{}, nil
+	})
+	r.Register("start", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		return &handler.ResponseHandlerFunc{Path: "name"}, nil
+	})
+
+	failing := true
+	r.SetCommitHook(func(u *handler.Context, res *handler.ResponseHandlerFunc) error {
+		if _, ok := repo.Get(KeyByUser(u)); ok {
+			t.Error("we expected the hook run before the state is saved")
+		}
+		if failing {
+			return fmt.Errorf("the outbox is full")
+		}
+		return nil
+	})
+
+	context := &handler.Context{
+		UserID: "1",
+		Update: &tgbotapi.Update{Message: &tgbotapi.Message{Text: "/start"}},
+	}
+
+	for i, testCase := range []struct {
+		failing     bool
+		expectError bool
+		expectState bool
+	}{
+		{failing: true, expectError: true, expectState: false},
+		{failing: false, expectError: false, expectState: true},
+	} {
+		failing = testCase.failing
+		res, err := r.Route(context)
+
+		if testCase.expectError && (err == nil || res != nil) {
+			t.Errorf("we expected an error and no response at %d but we got %v, %v", i, res, err)
+		}
+		if !testCase.expectError && (err != nil || res == nil) {
+			t.Errorf("we expected a response at %d but we got %v, %v", i, res, err)
+		}
+		if _, ok := repo.Get(KeyByUser(context)); ok != testCase.expectState {
+			t.Errorf("we expected state %t at %d but we got %t", testCase.expectState, i, ok)
+		}
+	}
+}
+
+func TestBinding(t *testing.T) {
+	repo, err := state.NewRepository("cache")
+	if err != nil {
+		t.Fatalf("failed to create cache state: %v", err)
+	}
+
+	r := New("root", repo)
+
+	reply := func(text string) *handler.ResponseHandlerFunc {
+		return &handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{{Text: text}},
+		}
+	}
+
+	r.Register("root", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		return reply("root"), nil
+	})
+	r.Register("search", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		return reply(fmt.Sprintf("search %s page %s", strings.Join(u.Args, " "), u.Query.Get("page"))), nil
+	})
+	r.Register("survey", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		res := reply("how old are you?")
+		res.Path = "survey/age?step=2"
+		res.Data = map[string]string{"name": "mic"}
+		return res, nil
+	})
+	r.Register("survey/age", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		var form struct {
+			Name string `state:"name"`
+			Step int    `query:"step"`
+		}
+		if err := u.Bind(&form); err != nil {
+			return nil, err
+		}
+		if _, err := strconv.Atoi(u.Message.Text); err != nil {
+			return nil, telecrafterror.Scope("test").BadRequest().UserFacing().DebuggingErrorf("send a number")
+		}
+		res := reply(fmt.Sprintf("%s is %s at step %d", form.Name, u.Message.Text, form.Step))
+		res.ReleaseState = true
+		return res, nil
+	})
+
+	message := func(text string) *handler.Context {
+		return &handler.Context{
+			UserID: "1",
+			Update: &tgbotapi.Update{Message: &tgbotapi.Message{Text: text}},
+		}
+	}
+
+	for i, testCase := range []struct {
+		input       *handler.Context
+		expected    string
+		expectError bool
+	}{
+		{input: message("/search?page=2 harry  potter"), expected: "search harry potter page 2"},
+		{input: message("/search"), expected: "search  page "},
+		{input: message("/survey"), expected: "how old are you?"},
+		{input: message("old"), expectError: true},
+		{input: message("30"), expected: "mic is 30 at step 2"},
+		{input: message("30"), expected: "root"},
+	} {
+		res, err := r.Route(testCase.input)
+		if (err != nil) != testCase.expectError {
+			t.Errorf("we expected error %v at %d but we got %v", testCase.expectError, i, err)
+		}
+		if testCase.expectError {
+			if res == nil || len(res.MessageConfigs) != 0 {
+				t.Errorf("we expected an empty response for a bad request at %d but we got %+v", i, res)
+			}
+			continue
+		}
+		if !isErrorConfigsMatched([]*tgbotapi.MessageConfig{{Text: testCase.expected}}, res.MessageConfigs) {
+			t.Errorf("we expected %s at %d but we got %v", testCase.expected, i, res.MessageConfigs[0].Text)
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	repo, err := state.NewRepository("cache")
+	if err != nil {
+		t.Fatalf("failed to create cache state: %v", err)
+	}
+
+	r := New("root", repo)
+
+	trace := func(name string) handler.Middleware {
+		return func(next handler.HandlerFunc) handler.HandlerFunc {
+			return func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+				if u.Data == nil {
+					u.Data = make(map[string]any)
+				}
+				trace, _ := u.Data["trace"].(string)
+				u.Data["trace"] = trace + ">" + name
+				return next(u)
+			}
+		}
+	}
+	reply := func(text string) handler.HandlerFunc {
+		return func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+			trace, _ := u.Data["trace"].(string)
+			return &handler.ResponseHandlerFunc{
+				MessageConfigs: []*tgbotapi.MessageConfig{{Text: text + trace}},
+			}, nil
+		}
+	}
+
+	r.Register("root", reply("root"))
+
+	admin := r.Group("admin", trace("admin"))
+	admin.Register("", reply("admin"))
+	admin.Register("stats", reply("stats"), trace("stats"))
+
+	users := admin.Group("/users/", trace("users"))
+	users.Register(":id", reply("user"))
+	users.Group("payments", trace("payments")).Register(":paymentID<int>", reply("payment"))
+
+	message := func(text string) *handler.Context {
+		return &handler.Context{
+			UserID: "1",
+			Update: &tgbotapi.Update{Message: &tgbotapi.Message{Text: text}},
+		}
+	}
+
+	for i, testCase := range []struct {
+		input    string
+		expected string
+	}{
+		{input: "/admin", expected: "admin>admin"},
+		{input: "/admin/stats", expected: "stats>admin>stats"},
+		{input: "/admin/users/7", expected: "user>admin>users"},
+		{input: "/admin/users/payments/3", expected: "payment>admin>users>payments"},
+		{input: "/admin/users/payments/x", expected: "root"},
+		{input: "/stats", expected: "root"},
+	} {
+		res, _ := r.Route(message(testCase.input))
+		if !isErrorConfigsMatched([]*tgbotapi.MessageConfig{{Text: testCase.expected}}, res.MessageConfigs) {
+			t.Errorf("we expected %s at %d but we got %v", testCase.expected, i, res.MessageConfigs[0].Text)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package telecraft
+
+import (
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/handler"
+	"github.com/mohamadrezamomeni/telecraft/state"
+)
+
+// screenTTL is how long the screen of a chat is remembered; it is how long
+// Telegram lets a bot delete its messages.
+const screenTTL = 48 * time.Hour
+
+// screenAction replaces the screen of the chat by messageConfig. A callback
+// query edits the screen, falling back to a new message; any other update
+// sends a new message, so the screen stays below what the user wrote.
+func (t *TeleCraft) screenAction(context *handler.Context, messageConfig *tgbotapi.MessageConfig) action {
+	messageID := t.screen(messageConfig.ChatID)
+	if messageID == 0 || context.CallbackQuery == nil {
+		return action{chattable: messageConfig, screen: true}
+	}
+
+	edit := editMessage(tgbotapi.BaseEdit{ChatID: messageConfig.ChatID, MessageID: messageID}, messageConfig)
+	if edit == nil {
+		return action{chattable: messageConfig, screen: true}
+	}
+	return action{chattable: edit, fallback: fallbackOf(messageConfig), screen: true}
+}
+
+// screen returns the message which is the screen of the chat, or zero.
+func (t *TeleCraft) screen(chatID int64) int {
+	if chatID == 0 {
+		return 0
+	}
+	if s, ok := t.stateRepo.Get(state.ScreenKey(chatID)); ok {
+		return s.MessageID
+	}
+	return 0
+}
+
+// replaceScreen makes messageID the screen of the chat and deletes the stale
+// one. Deleting may fail for messages older than two days, which is ignored.
+func (t *TeleCraft) replaceScreen(chatID int64, messageID int) {
+	if chatID == 0 || messageID == 0 {
+		return
+	}
+
+	stale := t.screen(chatID)
+	t.stateRepo.Set(state.ScreenKey(chatID), &state.State{
+		MessageID:  messageID,
+		Expiration: time.Now().Add(screenTTL),
+	})
+	if stale != 0 && stale != messageID {
+		t.request(tgbotapi.NewDeleteMessage(chatID, stale))
+	}
+}
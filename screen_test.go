@@ -0,0 +1,99 @@
+package telecraft
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/handler"
+	"github.com/mohamadrezamomeni/telecraft/state"
+	"github.com/mohamadrezamomeni/telecraft/telecrafttest"
+)
+
+func TestReplaceScreen(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBot(t, server)
+
+	messageUpdate := handler.NewContext(&tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 100,
+		From:      &tgbotapi.User{ID: 1},
+		Chat:      &tgbotapi.Chat{ID: 1, Type: "private"},
+	}})
+	callbackUpdate := handler.NewContext(&tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "1",
+		From:    &tgbotapi.User{ID: 1},
+		Message: &tgbotapi.Message{MessageID: 100, Chat: &tgbotapi.Chat{ID: 1, Type: "private"}},
+	}})
+
+	for i, testCase := range []struct {
+		context  *handler.Context
+		failure  string
+		expected []string
+	}{
+		{
+			context:  messageUpdate,
+			expected: []string{"sendMessage"},
+		},
+		{
+			context:  callbackUpdate,
+			expected: []string{"editMessageText:screen"},
+		},
+		{
+			context:  messageUpdate,
+			expected: []string{"sendMessage", "deleteMessage:stale"},
+		},
+		{
+			context:  callbackUpdate,
+			failure:  "Bad Request: message to edit not found",
+			expected: []string{"editMessageText:screen", "sendMessage", "deleteMessage:stale"},
+		},
+	} {
+		before := len(server.Requests(""))
+		stale := bot.screen(1)
+		if len(testCase.failure) > 0 {
+			server.Fail("editMessageText", http.StatusBadRequest, testCase.failure, 0)
+		}
+
+		msg := tgbotapi.NewMessage(1, "step "+strconv.Itoa(i))
+		bot.send(&handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&msg},
+			ReplaceScreen:  true,
+		}, testCase.context)
+
+		requests := server.Requests("")[before:]
+		methods := []string{}
+		for _, request := range requests {
+			method := request.Method
+			switch {
+			case request.Params.Get("message_id") != strconv.Itoa(stale):
+			case strings.HasPrefix(method, "edit"):
+				method += ":screen"
+			default:
+				method += ":stale"
+			}
+			methods = append(methods, method)
+		}
+		if strings.Join(methods, ",") != strings.Join(testCase.expected, ",") {
+			t.Errorf("we expected %v at %d but we got %v", testCase.expected, i, methods)
+		}
+
+		screen, ok := bot.stateRepo.Get(state.ScreenKey(1))
+		if !ok || screen.MessageID == 0 {
+			t.Fatalf("we expected the screen be kept at %d but we got %+v", i, screen)
+		}
+		last := requests[len(requests)-1]
+		if last.Method == "deleteMessage" {
+			last = requests[len(requests)-2]
+		}
+		if last.Method == "sendMessage" && screen.MessageID == stale {
+			t.Errorf("we expected the new message be the screen at %d", i)
+		}
+		if last.Method != "sendMessage" && screen.MessageID != stale {
+			t.Errorf("we expected the screen stay %d at %d but we got %d", stale, i, screen.MessageID)
+		}
+	}
+}
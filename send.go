@@ -0,0 +1,190 @@
+package telecraft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/handler"
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+)
+
+// send executes the actions of res in order. It stops once the chat turns out
+// to be forbidden, e.g. the user has blocked the bot, since the rest would
+// fail the same way.
+func (t *TeleCraft) send(res *handler.ResponseHandlerFunc, context *handler.Context) {
+	for _, a := range t.actions(res, context) {
+		chattable, message, err := t.sendAction(a)
+		if isNotModified(err) {
+			continue
+		}
+		if err != nil {
+			t.onSendError(context, chattable, err)
+			if IsBlocked(err) {
+				return
+			}
+			continue
+		}
+		if t.telecraftOptions.AfterSend != nil {
+			t.telecraftOptions.AfterSend(context, chattable, message)
+		}
+	}
+}
+
+func (t *TeleCraft) onSendError(context *handler.Context, chattable tgbotapi.Chattable, err error) {
+	if t.telecraftOptions.OnSendError != nil {
+		t.telecraftOptions.OnSendError(context, chattable, err)
+	}
+}
+
+// request sends chattable and decodes the message when Telegram returns one;
+// deletions and chat actions only return true, which Send fails to decode.
+// Errors are classified by sendError. Its waits end once serving has stopped
+// and draining gave up on the handlers.
+func (t *TeleCraft) request(chattable tgbotapi.Chattable) (tgbotapi.Message, error) {
+	return t.requestContext(t.sendContext(), chattable)
+}
+
+func (t *TeleCraft) sendContext() context.Context {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.sending
+}
+
+// requestContext is request giving up the waits for the rate limiter and
+// retries once ctx is done.
+func (t *TeleCraft) requestContext(ctx context.Context, chattable tgbotapi.Chattable) (tgbotapi.Message, error) {
+	resp, err := t.withRetry(ctx, chatIDOf(chattable), func() (*tgbotapi.APIResponse, error) {
+		return t.bot.Request(chattable)
+	})
+	return decodeMessage(fmt.Sprintf("%T", chattable), resp, err)
+}
+
+func decodeMessage(input string, resp *tgbotapi.APIResponse, err error) (tgbotapi.Message, error) {
+	var message tgbotapi.Message
+
+	if err != nil {
+		return message, sendError(input, err)
+	}
+
+	if len(resp.Result) > 0 && resp.Result[0] == '{' {
+		if err := json.Unmarshal(resp.Result, &message); err != nil {
+			return message, sendError(input, err)
+		}
+	}
+	return message, nil
+}
+
+// withRetry retries do in place, so the next request of the chat waits for
+// this one and the order of a response is kept. Every attempt waits for the
+// rate limiter first. Waits are capped by MaxRetryDelay, and a retry_after
+// longer than it gives up.
+func (t *TeleCraft) withRetry(ctx context.Context, chatID int64, do func() (*tgbotapi.APIResponse, error)) (*tgbotapi.APIResponse, error) {
+	backoff := t.telecraftOptions.RetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		if err := t.limiter.Wait(ctx, chatID); err != nil {
+			return nil, err
+		}
+
+		resp, err := do()
+		if err == nil || attempt >= t.telecraftOptions.MaxSendAttempts {
+			return resp, err
+		}
+
+		wait, ok := retryDelay(err, min(backoff, t.telecraftOptions.MaxRetryDelay))
+		if !ok || wait > t.telecraftOptions.MaxRetryDelay {
+			return resp, err
+		}
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// retryDelay tells whether err is worth a retry and how long to wait for it.
+// Errors of Telegram other than 429 and 5xx would fail the same way again.
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	var apiError *tgbotapi.Error
+	if !errors.As(err, &apiError) {
+		return backoff, true
+	}
+
+	switch {
+	case apiError.RetryAfter > 0:
+		return time.Duration(apiError.RetryAfter) * time.Second, true
+	case apiError.Code == http.StatusTooManyRequests, apiError.Code >= http.StatusInternalServerError:
+		return backoff, true
+	}
+	return 0, false
+}
+
+// chatIDOf finds the chat of chattable for the rate limiter. Chattables keep
+// it in their embedded BaseChat or BaseEdit; it is zero for the ones without
+// a chat, like answerCallbackQuery, or addressed by a channel username.
+func chatIDOf(chattable tgbotapi.Chattable) int64 {
+	value := reflect.ValueOf(chattable)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return 0
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return 0
+	}
+
+	field := value.FieldByName("ChatID")
+	if field.IsValid() && field.Kind() == reflect.Int64 {
+		return field.Int()
+	}
+	return 0
+}
+
+// sendError turns the error codes of Telegram into error types: 403 is
+// Forbidden, 400 is BadRequest and 429 is TooManyRequests. The *tgbotapi.Error
+// stays reachable by errors.As, e.g. for its RetryAfter.
+func sendError(input string, err error) error {
+	scope := "telecraft.send"
+
+	e := telecrafterror.Wrap(err).Scope(scope).Input(input)
+
+	var apiError *tgbotapi.Error
+	if errors.As(err, &apiError) {
+		switch apiError.Code {
+		case http.StatusForbidden:
+			e = e.Forbidden()
+		case http.StatusBadRequest:
+			e = e.BadRequest()
+		case http.StatusTooManyRequests:
+			e = e.TooManyRequests()
+		default:
+			e = e.UnExpected()
+		}
+	}
+	return e.Errorf("error to send to telegram")
+}
+
+// IsBlocked reports whether err is a send error saying the bot may not write
+// to the chat anymore, e.g. the user has blocked it or it was kicked.
+func IsBlocked(err error) bool {
+	return hasSendErrorType(err, telecrafterror.Forbidden)
+}
+
+// IsTooManyRequests reports whether err is a send error of Telegram throttling the bot.
+func IsTooManyRequests(err error) bool {
+	return hasSendErrorType(err, telecrafterror.TooManyRequests)
+}
+
+func hasSendErrorType(err error, errorType telecrafterror.ErrorType) bool {
+	e, ok := telecrafterror.GetMomoError(err)
+	return ok && e.GetErrorType() == errorType
+}
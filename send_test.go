@@ -0,0 +1,261 @@
+package telecraft
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/handler"
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+	"github.com/mohamadrezamomeni/telecraft/ratelimit"
+	"github.com/mohamadrezamomeni/telecraft/telecrafttest"
+)
+
+func TestSendErrors(t *testing.T) {
+	for i, testCase := range []struct {
+		code         int
+		description  string
+		errorType    telecrafterror.ErrorType
+		expectedSent int
+		expectedRuns int
+	}{
+		{
+			code:         http.StatusForbidden,
+			description:  "Forbidden: bot was blocked by the user",
+			errorType:    telecrafterror.Forbidden,
+			expectedSent: 0,
+			expectedRuns: 1,
+		},
+		{
+			code:         http.StatusBadRequest,
+			description:  "Bad Request: can't parse entities",
+			errorType:    telecrafterror.BadRequest,
+			expectedSent: 1,
+			expectedRuns: 2,
+		},
+		{
+			code:         http.StatusTooManyRequests,
+			description:  "Too Many Requests: retry after 1",
+			errorType:    telecrafterror.TooManyRequests,
+			expectedSent: 1,
+			expectedRuns: 2,
+		},
+	} {
+		server := telecrafttest.NewServer()
+		bot := newTestBot(t, server)
+		bot.telecraftOptions.MaxSendAttempts = 1
+
+		sendErrors := []error{}
+		sent := []tgbotapi.Message{}
+		bot.telecraftOptions.OnSendError = func(_ *handler.Context, _ tgbotapi.Chattable, err error) {
+			sendErrors = append(sendErrors, err)
+		}
+		bot.telecraftOptions.AfterSend = func(_ *handler.Context, _ tgbotapi.Chattable, message tgbotapi.Message) {
+			sent = append(sent, message)
+		}
+
+		server.Fail("sendMessage", testCase.code, testCase.description, 0)
+
+		first := tgbotapi.NewMessage(1, "first")
+		second := tgbotapi.NewMessage(1, "second")
+		bot.send(&handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&first, &second},
+		}, &handler.Context{ChatID: 1})
+		server.Close()
+
+		if len(sendErrors) != 1 {
+			t.Fatalf("we expected one send error at %d but we got %d", i, len(sendErrors))
+		}
+		e, ok := telecrafterror.GetMomoError(sendErrors[0])
+		if !ok || e.GetErrorType() != testCase.errorType {
+			t.Errorf("we expected error type %d at %d but we got %v", testCase.errorType, i, sendErrors[0])
+		}
+		if IsBlocked(sendErrors[0]) != (testCase.code == http.StatusForbidden) {
+			t.Errorf("IsBlocked was wrong at %d", i)
+		}
+		if IsTooManyRequests(sendErrors[0]) != (testCase.code == http.StatusTooManyRequests) {
+			t.Errorf("IsTooManyRequests was wrong at %d", i)
+		}
+
+		if len(sent) != testCase.expectedSent {
+			t.Errorf("we expected %d sent messages at %d but we got %d", testCase.expectedSent, i, len(sent))
+		}
+		if len(sent) > 0 && (sent[0].Text != "second" || sent[0].MessageID == 0) {
+			t.Errorf("we expected the returned second message at %d but we got %+v", i, sent[0])
+		}
+		if runs := len(server.Requests("sendMessage")); runs != testCase.expectedRuns {
+			t.Errorf("we expected %d calls at %d but we got %d", testCase.expectedRuns, i, runs)
+		}
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	for i, testCase := range []struct {
+		failures      []int
+		retryAfter    int
+		maxAttempts   int
+		maxRetryDelay time.Duration
+		expectError   bool
+		expectedCalls int
+		minDuration   time.Duration
+	}{
+		{
+			failures:      []int{http.StatusTooManyRequests},
+			retryAfter:    1,
+			maxAttempts:   3,
+			expectedCalls: 3,
+			minDuration:   time.Second,
+		},
+		{
+			failures:      []int{http.StatusBadGateway, http.StatusInternalServerError},
+			maxAttempts:   3,
+			expectedCalls: 4,
+		},
+		{
+			failures:      []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			maxAttempts:   3,
+			expectError:   true,
+			expectedCalls: 4,
+		},
+		{
+			failures:      []int{http.StatusBadRequest},
+			maxAttempts:   3,
+			expectError:   true,
+			expectedCalls: 2,
+		},
+		{
+			failures:      []int{http.StatusTooManyRequests},
+			retryAfter:    60,
+			maxAttempts:   3,
+			maxRetryDelay: time.Second,
+			expectError:   true,
+			expectedCalls: 2,
+		},
+	} {
+		server := telecrafttest.NewServer()
+		bot := newTestBot(t, server)
+		bot.telecraftOptions.MaxSendAttempts = testCase.maxAttempts
+		bot.telecraftOptions.RetryBackoff = time.Millisecond
+		if testCase.maxRetryDelay > 0 {
+			bot.telecraftOptions.MaxRetryDelay = testCase.maxRetryDelay
+		}
+
+		sendErrors := []error{}
+		bot.telecraftOptions.OnSendError = func(_ *handler.Context, _ tgbotapi.Chattable, err error) {
+			sendErrors = append(sendErrors, err)
+		}
+
+		for _, code := range testCase.failures {
+			server.Fail("sendMessage", code, "failed", testCase.retryAfter)
+		}
+
+		first := tgbotapi.NewMessage(1, "first")
+		second := tgbotapi.NewMessage(1, "second")
+		started := time.Now()
+		bot.send(&handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&first, &second},
+		}, &handler.Context{ChatID: 1})
+		elapsed := time.Since(started)
+		server.Close()
+
+		if testCase.expectError != (len(sendErrors) == 1) {
+			t.Errorf("we expected error %t at %d but we got %v", testCase.expectError, i, sendErrors)
+		}
+		if elapsed < testCase.minDuration {
+			t.Errorf("we expected retry_after be honoured at %d but it took %s", i, elapsed)
+		}
+
+		requests := server.Requests("sendMessage")
+		if len(requests) != testCase.expectedCalls {
+			t.Fatalf("we expected %d calls at %d but we got %d", testCase.expectedCalls, i, len(requests))
+		}
+		if requests[len(requests)-1].Text() != "second" {
+			t.Errorf("we expected second be sent last at %d but we got %s", i, requests[len(requests)-1].Text())
+		}
+		for _, request := range requests[:len(requests)-1] {
+			if !testCase.expectError && request.Text() != "first" {
+				t.Errorf("we expected first be retried before second at %d", i)
+			}
+		}
+	}
+}
+
+func TestChatIDOf(t *testing.T) {
+	for i, testCase := range []struct {
+		chattable tgbotapi.Chattable
+		expected  int64
+	}{
+		{chattable: tgbotapi.NewMessage(5, "hi"), expected: 5},
+		{chattable: &tgbotapi.MessageConfig{BaseChat: tgbotapi.BaseChat{ChatID: -100}}, expected: -100},
+		{chattable: tgbotapi.NewPhoto(6, tgbotapi.FileID("photo")), expected: 6},
+		{chattable: tgbotapi.NewEditMessageText(7, 1, "edited"), expected: 7},
+		{chattable: tgbotapi.NewDeleteMessage(8, 1), expected: 8},
+		{chattable: tgbotapi.NewCallback("id", "done"), expected: 0},
+		{chattable: tgbotapi.NewMessageToChannel("@channel", "hi"), expected: 0},
+	} {
+		if chatID := chatIDOf(testCase.chattable); chatID != testCase.expected {
+			t.Errorf("we expected chat %d at %d but we got %d", testCase.expected, i, chatID)
+		}
+	}
+}
+
+func TestSendIsRateLimited(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBot(t, server)
+	bot.limiter = ratelimit.New(ratelimit.Limits{Chat: ratelimit.Every(1, 50*time.Millisecond)})
+
+	messages := []*tgbotapi.MessageConfig{}
+	for _, text := range []string{"one", "two", "three"} {
+		msg := tgbotapi.NewMessage(1, text)
+		messages = append(messages, &msg)
+	}
+
+	started := time.Now()
+	bot.send(&handler.ResponseHandlerFunc{MessageConfigs: messages}, &handler.Context{ChatID: 1})
+	if elapsed := time.Since(started); elapsed < 100*time.Millisecond {
+		t.Errorf("we expected the sends be spread over 100ms but they took %s", elapsed)
+	}
+	if sent := len(server.Requests("sendMessage")); sent != 3 {
+		t.Errorf("we expected 3 messages but we got %d", sent)
+	}
+}
+
+func TestSendsStopWithDrain(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBot(t, server)
+	bot.limiter = ratelimit.New(ratelimit.Limits{Chat: ratelimit.Every(1, time.Hour)})
+	if _, err := bot.start(context.Background()); err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+
+	first := tgbotapi.NewMessage(1, "first")
+	second := tgbotapi.NewMessage(1, "second")
+	sent := make(chan struct{})
+	go func() {
+		bot.send(&handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&first, &second},
+		}, &handler.Context{ChatID: 1})
+		close(sent)
+	}()
+
+	if _, err := server.WaitForRequests("sendMessage", 1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	bot.drain()
+	bot.stop()
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("we expected the send give up waiting for the rate limiter once drained")
+	}
+	if sent := len(server.Requests("sendMessage")); sent != 1 {
+		t.Errorf("we expected only the first message be sent but we got %d", sent)
+	}
+}
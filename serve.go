@@ -0,0 +1,342 @@
+package telecraft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/dispatcher"
+	"github.com/mohamadrezamomeni/telecraft/handler"
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+)
+
+const busyRepliesSize = 16
+
+// Serve polls Telegram for updates until ctx is done or Shutdown is called,
+// then waits for in-flight handlers and closes the state repository. The
+// repository is left open when the handlers don't finish in time.
+func (t *TeleCraft) Serve(ctx context.Context) error {
+	ctx, err := t.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.stop()
+
+	busy := t.busyReplies()
+	defer close(busy)
+
+	for handlerContext := range t.pollUpdates(ctx) {
+		if err := t.dispatch(handlerContext); errors.Is(err, dispatcher.ErrQueueFull) {
+			select {
+			case busy <- handlerContext:
+			default:
+			}
+		}
+	}
+	return t.drain()
+}
+
+// Shutdown stops the running Serve, ServeWebhook or StartWebhook and waits
+// until it has drained or ctx is done.
+func (t *TeleCraft) Shutdown(ctx context.Context) error {
+	scope := "telecraft.shutdown"
+
+	t.mutex.Lock()
+	cancel, stopped := t.cancel, t.stopped
+	t.mutex.Unlock()
+
+	if cancel == nil {
+		return telecrafterror.Scope(scope).NotFound().Errorf("telecraft isn't serving")
+	}
+	cancel()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return telecrafterror.Wrap(ctx.Err()).Scope(scope).Errorf("shutdown has been interrupted")
+	}
+}
+
+func (t *TeleCraft) start(ctx context.Context) (context.Context, error) {
+	scope := "telecraft.start"
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.cancel != nil {
+		return nil, telecrafterror.Scope(scope).Duplicate().Errorf("telecraft is already serving")
+	}
+
+	if t.dispatcher.IsClosed() {
+		t.dispatcher = newDispatcher(t.telecraftOptions)
+	}
+
+	t.startOutbox()
+	t.sending, t.stopSending = context.WithCancel(context.Background())
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.cancel = cancel
+	t.stopped = make(chan struct{})
+	return ctx, nil
+}
+
+// abort undoes start when serving can't begin. Nothing was dispatched, so
+// only the outbox has to stop; its entries are kept for the next start.
+func (t *TeleCraft) abort() {
+	if t.outbox != nil {
+		t.outbox.cancel()
+		<-t.outbox.stopped
+	}
+
+	t.mutex.Lock()
+	t.stopSending()
+	t.mutex.Unlock()
+
+	t.stop()
+}
+
+func (t *TeleCraft) stop() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.cancel()
+	close(t.stopped)
+	t.cancel = nil
+}
+
+// pollUpdates only advances the offset for updates which were handed over, so
+// whatever is fetched after ctx is done gets redelivered on the next start.
+// A poll in flight is abandoned once ctx is done, and the channel is closed
+// once polling has stopped.
+func (t *TeleCraft) pollUpdates(ctx context.Context) <-chan *handler.Context {
+	scope := "telecraft.pollUpdates"
+
+	updates := make(chan *handler.Context)
+	config := tgbotapi.NewUpdate(0)
+	config.Timeout = t.telecraftOptions.Timeout
+
+	go func() {
+		defer close(updates)
+
+		confirmed := config.Offset
+	poll:
+		for ctx.Err() == nil {
+			batch, last, err := t.pollOnce(ctx, config)
+			if ctx.Err() != nil {
+				break
+			}
+			if err != nil {
+				telecrafterror.Wrap(err).Scope(scope).Errorf("failed to get updates, retrying in 3 seconds")
+				select {
+				case <-ctx.Done():
+				case <-time.After(3 * time.Second):
+				}
+				continue
+			}
+			confirmed = config.Offset
+
+			for _, handlerContext := range batch {
+				if handlerContext.UpdateID < config.Offset {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					break poll
+				case updates <- handlerContext:
+					config.Offset = handlerContext.UpdateID + 1
+				}
+			}
+			// updates which couldn't be decoded are skipped too
+			if last >= config.Offset {
+				config.Offset = last + 1
+			}
+		}
+
+		if config.Offset > confirmed {
+			t.confirmUpdates(config)
+		}
+	}()
+
+	return updates
+}
+
+// pollOnce is getUpdates giving up once ctx is done, instead of holding the
+// stop for up to the long polling timeout. The result of the request left
+// behind is dropped, and its updates are redelivered since the offset didn't
+// move past them.
+func (t *TeleCraft) pollOnce(ctx context.Context, config tgbotapi.UpdateConfig) ([]*handler.Context, int, error) {
+	type result struct {
+		batch []*handler.Context
+		last  int
+		err   error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		batch, last, err := t.getUpdates(config)
+		done <- result{batch: batch, last: last, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	case r := <-done:
+		return r.batch, r.last, r.err
+	}
+}
+
+// confirmUpdates tells Telegram the updates before the offset of config are
+// done with, which otherwise only the next poll does. Whatever it fetches is
+// left for the next start.
+func (t *TeleCraft) confirmUpdates(config tgbotapi.UpdateConfig) {
+	scope := "telecraft.confirmUpdates"
+
+	config.Timeout = 0
+	config.Limit = 1
+	if _, err := t.bot.Request(config); err != nil {
+		telecrafterror.Wrap(err).Scope(scope).Input(config.Offset).Errorf("the handled updates couldn't be confirmed, they will be delivered again")
+	}
+}
+
+// getUpdates decodes the raw result itself, since the update types of
+// tgbotapi drop fields like message_thread_id. Updates failing to decode are
+// logged and left out; last is the largest update_id of the result, theirs
+// included, so polling can move past them.
+func (t *TeleCraft) getUpdates(config tgbotapi.UpdateConfig) ([]*handler.Context, int, error) {
+	scope := "telecraft.getUpdates"
+
+	resp, err := t.bot.Request(config)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(resp.Result, &raws); err != nil {
+		return nil, 0, err
+	}
+
+	batch := make([]*handler.Context, 0, len(raws))
+	last := 0
+	for _, raw := range raws {
+		var id struct {
+			UpdateID int `json:"update_id"`
+		}
+		json.Unmarshal(raw, &id)
+		last = max(last, id.UpdateID)
+
+		handlerContext, err := decodeUpdate(raw)
+		if err != nil {
+			telecrafterror.Wrap(err).Scope(scope).BadRequest().Input(id.UpdateID).Errorf("error to decode the update, it is skipped")
+			continue
+		}
+		batch = append(batch, handlerContext)
+	}
+	return batch, last, nil
+}
+
+// dispatch keeps the updates of one chat, and of one user across chats, in
+// order while the others are handled in parallel; states may be keyed by
+// either, see router.KeyStrategy. It fails when the update is rejected by a
+// full queue or serving has stopped.
+func (t *TeleCraft) dispatch(handlerContext *handler.Context) error {
+	t.mutex.Lock()
+	d := t.dispatcher
+	t.mutex.Unlock()
+
+	return d.SubmitKeys(orderingKeys(handlerContext), func() {
+		t.handleRequest(handlerContext)
+	})
+}
+
+func orderingKeys(handlerContext *handler.Context) []string {
+	keys := []string{}
+	if handlerContext.HasChat() {
+		keys = append(keys, "chat:"+strconv.FormatInt(handlerContext.ChatID, 10))
+	}
+	if len(handlerContext.UserID) > 0 {
+		keys = append(keys, "user:"+handlerContext.UserID)
+	}
+	return keys
+}
+
+// busyReplies replies BusyMessage to the updates sent to it one at a time.
+// Callers drop the replies which don't fit in its buffer, since under that
+// load they would only slow the bot down further.
+func (t *TeleCraft) busyReplies() chan<- *handler.Context {
+	busy := make(chan *handler.Context, busyRepliesSize)
+	go func() {
+		for handlerContext := range busy {
+			t.replyBusy(handlerContext)
+		}
+	}()
+	return busy
+}
+
+func (t *TeleCraft) replyBusy(handlerContext *handler.Context) {
+	// the answer of a callback query already shows the message
+	if handlerContext.CallbackQuery != nil {
+		t.answerCallback(handlerContext, &handler.ResponseHandlerFunc{
+			CallbackAnswer: &handler.CallbackAnswer{Text: t.telecraftOptions.BusyMessage},
+		})
+		return
+	}
+	if len(t.telecraftOptions.BusyMessage) == 0 || !handlerContext.HasChat() {
+		return
+	}
+	t.request(tgbotapi.NewMessage(handlerContext.ChatID, t.telecraftOptions.BusyMessage))
+}
+
+// QueueStats reports the depth of the update queue for monitoring.
+func (t *TeleCraft) QueueStats() dispatcher.Stats {
+	t.mutex.Lock()
+	d := t.dispatcher
+	t.mutex.Unlock()
+
+	return d.Stats()
+}
+
+func newDispatcher(telecraftOptions *TeleCraftOptions) *dispatcher.Dispatcher {
+	return dispatcher.New(telecraftOptions.MaxGoroutines, telecraftOptions.QueueSize, telecraftOptions.OverflowPolicy)
+}
+
+func (t *TeleCraft) drain() error {
+	scope := "telecraft.drain"
+
+	timeout := t.telecraftOptions.ShutdownTimeout
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	t.mutex.Lock()
+	d := t.dispatcher
+	t.mutex.Unlock()
+
+	shutdownErr := d.Shutdown(ctx)
+
+	// the handlers still running give up their sends
+	t.mutex.Lock()
+	t.stopSending()
+	t.mutex.Unlock()
+
+	var err error
+	if shutdownErr != nil {
+		err = telecrafterror.Wrap(shutdownErr).Scope(scope).Input(timeout.String()).Errorf("in-flight handlers didn't finish in time")
+	}
+
+	if outboxErr := t.stopOutbox(ctx); outboxErr != nil && err == nil {
+		err = outboxErr
+	}
+
+	// the handlers still running keep using the states
+	if shutdownErr != nil {
+		return err
+	}
+	if closeErr := t.stateRepo.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
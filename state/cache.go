@@ -47,3 +47,10 @@ func (c *Cache) Delete(key string) error {
 	delete(c.data, key)
 	return nil
 }
+
+func (c *Cache) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.data = make(map[string]*State)
+	return nil
+}
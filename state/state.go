@@ -1,9 +1,20 @@
 package state
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
 
 type State struct {
-	Data       map[string]string
-	Path       string
+	Data map[string]string
+	Path string
+	// MessageID is the message of the bot that a single-message UI keeps
+	// editing in the chat; it is kept under its own key, see ScreenKey.
+	MessageID  int
 	Expiration time.Time
 }
+
+// ScreenKey is the key of the state holding the screen of a chat.
+func ScreenKey(chatID int64) string {
+	return "screen:" + strconv.FormatInt(chatID, 10)
+}
@@ -8,6 +8,7 @@ type Repo interface {
 	Set(key string, state *State) error
 	Get(key string) (*State, bool)
 	Delete(key string) error
+	Close() error
 }
 
 func NewRepository(repoType string) (Repo, error) {
@@ -1,9 +1,14 @@
 package telecraft
 
 import (
+	"context"
+	"sync"
+
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/dispatcher"
 	"github.com/mohamadrezamomeni/telecraft/handler"
 	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+	"github.com/mohamadrezamomeni/telecraft/ratelimit"
 	"github.com/mohamadrezamomeni/telecraft/router"
 	"github.com/mohamadrezamomeni/telecraft/state"
 )
@@ -11,67 +16,129 @@ import (
 type TeleCraft struct {
 	Router           *router.Router
 	telecraftOptions *TeleCraftOptions
-	bot              *tgbotapi.BotAPI
-}
-
-type TeleCraftOptions struct {
-	RepoType      string
-	DefaultRoute  string
-	maxGoroutines int
-	Timeout       int
-	Token         string
-	errorMessage  string
+	bot              BotClient
+	stateRepo        state.Repo
+	dispatcher       *dispatcher.Dispatcher
+	limiter          *ratelimit.Limiter
+	outbox           *outboxState
+	mutex            sync.Mutex
+	cancel           func()
+	stopped          chan struct{}
+	sending          context.Context
+	stopSending      func()
 }
 
-func New(telecraftOptions *TeleCraftOptions) *TeleCraft {
+func New(telecraftOptions *TeleCraftOptions) (*TeleCraft, error) {
 	scope := "new.Telecraft"
 
-	bot, err := tgbotapi.NewBotAPI(telecraftOptions.Token)
-	if err != nil {
-		panic(telecrafterror.Wrap(err).Scope(scope).BadRequest().Errorf("error to initialize bot"))
+	if telecraftOptions == nil {
+		telecraftOptions = &TeleCraftOptions{}
+	}
+	telecraftOptions = telecraftOptions.withDefaults()
+	if err := telecraftOptions.validate(); err != nil {
+		return nil, err
 	}
 
 	stateRepo, err := state.NewRepository(telecraftOptions.RepoType)
 	if err != nil {
-		panic(err.Error())
+		return nil, telecrafterror.Wrap(err).Scope(scope).BadRequest().Input(telecraftOptions.RepoType).Errorf("the repo type is unknown")
 	}
 
-	return &TeleCraft{
+	bot, err := newBotClient(telecraftOptions)
+	if err != nil {
+		return nil, telecrafterror.Wrap(err).Scope(scope).BadRequest().Errorf("error to initialize bot")
+	}
+
+	outbox, err := newOutbox(telecraftOptions)
+	if err != nil {
+		return nil, telecrafterror.Wrap(err).Scope(scope).Input(telecraftOptions.OutboxPath).Errorf("error to open the outbox")
+	}
+
+	r := router.New(telecraftOptions.DefaultRoute, stateRepo)
+	r.SetKeyStrategy(telecraftOptions.StateKeyStrategy)
+	r.SetStateTTL(telecraftOptions.StateTTL)
+
+	t := &TeleCraft{
 		bot:              bot,
-		Router:           router.New(telecraftOptions.RepoType, stateRepo),
+		Router:           r,
 		telecraftOptions: telecraftOptions,
+		stateRepo:        stateRepo,
+		dispatcher:       newDispatcher(telecraftOptions),
+		limiter:          ratelimit.New(*telecraftOptions.RateLimits),
+		outbox:           outbox,
+		sending:          context.Background(),
+		stopSending:      func() {},
+	}
+	if outbox != nil {
+		r.SetCommitHook(t.commitOutbox)
 	}
+	return t, nil
 }
 
-func (t *TeleCraft) Serve() {
-	u := tgbotapi.NewUpdate(t.telecraftOptions.Timeout)
-	updates := t.bot.GetUpdatesChan(u)
+func (t *TeleCraft) handleRequest(context *handler.Context) {
+	scope := "telecraft.handleRequest"
 
-	limiter := make(chan struct{}, t.telecraftOptions.maxGoroutines)
-	for update := range updates {
-		go t.handleRequest(&update, limiter)
+	res, err := t.Router.Route(context)
+	if err != nil {
+		telecrafterror.Wrap(err).Scope(scope).Input(context.UserID, context.ChatID).Errorf("the handler has failed")
+		t.replyError(context, err)
+	}
+
+	t.answerCallback(context, res)
+
+	// with the outbox the response is already saved and sent in the background
+	if res != nil && t.outbox == nil {
+		t.send(res, context)
 	}
 }
 
-func (t *TeleCraft) handleRequest(update *tgbotapi.Update, limiter chan struct{}) {
-	limiter <- struct{}{}
+// replyError tells the user the update has failed. An error marked as
+// UserFacing, like one of Context.Bind, is about what the user sent, so its
+// message is replied instead of ErrorMessage.
+func (t *TeleCraft) replyError(context *handler.Context, err error) {
+	if !context.HasChat() {
+		return
+	}
 
-	context := &handler.Context{
-		Update: update,
+	message := t.telecraftOptions.ErrorMessage
+	if userMessage, ok := telecrafterror.UserMessage(err); ok && len(userMessage) > 0 {
+		message = userMessage
+	}
+	if len(message) == 0 {
+		return
 	}
+	t.request(tgbotapi.NewMessage(context.ChatID, message))
+}
 
-	// TODO: need to handle this error
-	res, _ := t.Router.Route(context)
+// answerCallback stops the spinner of the pressed button, with the answer of
+// the response if it has one. Handlers sending a tgbotapi.CallbackConfig
+// themselves are left alone, as a query can be answered only once.
+func (t *TeleCraft) answerCallback(context *handler.Context, res *handler.ResponseHandlerFunc) {
+	if context.CallbackQuery == nil {
+		return
+	}
 
+	answer := &handler.CallbackAnswer{}
 	if res != nil {
-		t.send(res, context)
+		for _, chattable := range res.Chattables {
+			switch chattable.(type) {
+			case tgbotapi.CallbackConfig, *tgbotapi.CallbackConfig:
+				return
+			}
+		}
+		if res.CallbackAnswer != nil {
+			answer = res.CallbackAnswer
+		}
 	}
 
-	<-limiter
-}
-
-func (t *TeleCraft) send(res *handler.ResponseHandlerFunc, context *handler.Context) {
-	for _, messageConfig := range res.MessageConfigs {
-		t.bot.Send(messageConfig)
+	config := tgbotapi.CallbackConfig{
+		CallbackQueryID: context.CallbackQuery.ID,
+		Text:            answer.Text,
+		ShowAlert:       answer.ShowAlert,
+		URL:             answer.URL,
+		CacheTime:       answer.CacheTime,
+	}
+	if _, err := t.request(config); err != nil {
+		t.onSendError(context, config, err)
 	}
 }
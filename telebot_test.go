@@ -0,0 +1,677 @@
+package telecraft
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/handler"
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+	"github.com/mohamadrezamomeni/telecraft/ratelimit"
+	"github.com/mohamadrezamomeni/telecraft/telecrafttest"
+)
+
+type fakeClient struct {
+	mutex   sync.Mutex
+	updates []tgbotapi.Update
+	sent    []tgbotapi.Chattable
+	offset  int
+	// hold is how long a long poll without updates waits, like Telegram does
+	hold time.Duration
+}
+
+func (f *fakeClient) push(update tgbotapi.Update) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	update.UpdateID = len(f.updates) + 1
+	f.updates = append(f.updates, update)
+}
+
+func (f *fakeClient) sentTexts() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	texts := []string{}
+	for _, c := range f.sent {
+		if messageConfig, ok := c.(*tgbotapi.MessageConfig); ok {
+			texts = append(texts, messageConfig.Text)
+		}
+		if messageConfig, ok := c.(tgbotapi.MessageConfig); ok {
+			texts = append(texts, messageConfig.Text)
+		}
+	}
+	return texts
+}
+
+func (f *fakeClient) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.sent = append(f.sent, c)
+	return tgbotapi.Message{MessageID: len(f.sent)}, nil
+}
+
+func (f *fakeClient) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	config, ok := c.(tgbotapi.UpdateConfig)
+	if !ok {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		f.sent = append(f.sent, c)
+		return &tgbotapi.APIResponse{Ok: true, Result: json.RawMessage("true")}, nil
+	}
+
+	f.mutex.Lock()
+	f.offset = config.Offset
+	batch := []tgbotapi.Update{}
+	for _, update := range f.updates {
+		if update.UpdateID >= config.Offset {
+			batch = append(batch, update)
+		}
+	}
+	f.mutex.Unlock()
+
+	switch {
+	case len(batch) == 0 && config.Timeout > 0 && f.hold > 0:
+		time.Sleep(f.hold)
+	case len(batch) == 0:
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	result, err := json.Marshal(batch)
+	return &tgbotapi.APIResponse{Ok: true, Result: result}, err
+}
+
+func (f *fakeClient) MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	return &tgbotapi.APIResponse{Ok: true, Result: json.RawMessage("true")}, nil
+}
+
+func (f *fakeClient) UploadFiles(endpoint string, params tgbotapi.Params, files []tgbotapi.RequestFile) (*tgbotapi.APIResponse, error) {
+	return &tgbotapi.APIResponse{Ok: true, Result: json.RawMessage("true")}, nil
+}
+
+func (f *fakeClient) GetFile(config tgbotapi.FileConfig) (tgbotapi.File, error) {
+	return tgbotapi.File{FileID: config.FileID}, nil
+}
+
+func (f *fakeClient) GetFileDirectURL(fileID string) (string, error) {
+	return "https://example.com/" + fileID, nil
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("the condition wasn't met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestServeWithFakeClient(t *testing.T) {
+	client := &fakeClient{}
+
+	bot, err := New(&TeleCraftOptions{Client: client, RateLimits: &ratelimit.Limits{}})
+	if err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+
+	bot.Router.Register("root", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		msg := tgbotapi.NewMessage(u.ChatID, "echo "+u.Message.Text)
+		return &handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&msg},
+		}, nil
+	})
+
+	served := make(chan error)
+	go func() {
+		served <- bot.Serve(context.Background())
+	}()
+
+	for _, text := range []string{"one", "two", "three"} {
+		client.push(tgbotapi.Update{
+			Message: &tgbotapi.Message{
+				Text: text,
+				From: &tgbotapi.User{ID: 1},
+				Chat: &tgbotapi.Chat{ID: 1, Type: "private"},
+			},
+		})
+	}
+
+	waitFor(t, func() bool { return len(client.sentTexts()) == 3 })
+
+	if err := bot.Shutdown(context.Background()); err != nil {
+		t.Errorf("we didn't expect error on shutdown but we got %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("we didn't expect error from serve but we got %v", err)
+	}
+
+	for i, text := range []string{"echo one", "echo two", "echo three"} {
+		if client.sentTexts()[i] != text {
+			t.Errorf("we expected %s at %d but we got %s", text, i, client.sentTexts()[i])
+		}
+	}
+
+	if client.offset != 4 {
+		t.Errorf("we expected the handled updates be confirmed with offset 4 but we got %d", client.offset)
+	}
+}
+
+func TestShutdownInterruptsLongPoll(t *testing.T) {
+	client := &fakeClient{hold: 5 * time.Second}
+
+	bot, err := New(&TeleCraftOptions{Client: client, RateLimits: &ratelimit.Limits{}, Timeout: 5})
+	if err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+
+	bot.Router.Register("root", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		msg := tgbotapi.NewMessage(u.ChatID, "echo "+u.Message.Text)
+		return &handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&msg},
+		}, nil
+	})
+
+	client.push(tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			Text: "one",
+			From: &tgbotapi.User{ID: 1},
+			Chat: &tgbotapi.Chat{ID: 1, Type: "private"},
+		},
+	})
+
+	served := make(chan error)
+	go func() {
+		served <- bot.Serve(context.Background())
+	}()
+	waitFor(t, func() bool { return len(client.sentTexts()) == 1 })
+	// the next poll is held
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := bot.Shutdown(ctx); err != nil {
+		t.Fatalf("we expected the long poll be interrupted but we got %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("we didn't expect error from serve but we got %v", err)
+	}
+}
+
+func TestDrainTimeoutKeepsStates(t *testing.T) {
+	client := &fakeClient{}
+
+	bot, err := New(&TeleCraftOptions{Client: client, RateLimits: &ratelimit.Limits{}, ShutdownTimeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	bot.Router.Register("root", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		return nil, nil
+	})
+	bot.Router.Register("start", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		return &handler.ResponseHandlerFunc{Path: "name"}, nil
+	})
+	bot.Router.Register("slow", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		<-release
+		return nil, nil
+	})
+
+	served := make(chan error)
+	go func() {
+		served <- bot.Serve(context.Background())
+	}()
+
+	for userID, text := range map[int64]string{1: "/start", 2: "/slow"} {
+		client.push(tgbotapi.Update{
+			Message: &tgbotapi.Message{
+				Text: text,
+				From: &tgbotapi.User{ID: userID},
+				Chat: &tgbotapi.Chat{ID: userID, Type: "private"},
+			},
+		})
+	}
+
+	waitFor(t, func() bool {
+		_, ok := bot.stateRepo.Get("user:1")
+		return ok && bot.QueueStats().Running == 1
+	})
+
+	bot.Shutdown(context.Background())
+	if err := <-served; err == nil {
+		t.Error("we expected an error when the handlers didn't finish in time")
+	}
+
+	if _, ok := bot.stateRepo.Get("user:1"); !ok {
+		t.Error("we expected the states be kept while a handler is still running")
+	}
+}
+
+func newTestBot(t *testing.T, server *telecrafttest.Server) *TeleCraft {
+	return newTestBotWithOptions(t, server, &TeleCraftOptions{})
+}
+
+func newTestBotWithOptions(t *testing.T, server *telecrafttest.Server, telecraftOptions *TeleCraftOptions) *TeleCraft {
+	telecraftOptions.Token = telecrafttest.Token
+	telecraftOptions.APIEndpoint = server.APIEndpoint()
+	telecraftOptions.Timeout = 1
+	if telecraftOptions.RateLimits == nil {
+		telecraftOptions.RateLimits = &ratelimit.Limits{}
+	}
+
+	bot, err := New(telecraftOptions)
+	if err != nil {
+		t.Fatalf("we didn't expect error but we got %v", err)
+	}
+
+	bot.Router.Register("root", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		msg := tgbotapi.NewMessage(u.ChatID, "root")
+		return &handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&msg},
+		}, nil
+	})
+	bot.Router.Register("start", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		msg := tgbotapi.NewMessage(u.ChatID, "what is your name?")
+		return &handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&msg},
+			Path:           "name",
+		}, nil
+	})
+	bot.Router.Register("name", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		msg := tgbotapi.NewMessage(u.ChatID, "hello "+u.Message.Text)
+		return &handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&msg},
+			ReleaseState:   true,
+		}, nil
+	})
+	bot.Router.Register("books/:id", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		msg := tgbotapi.NewMessage(u.ChatID, "book "+u.Params["id"])
+		return &handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&msg},
+		}, nil
+	})
+	bot.Router.Register("cover/:id", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		caption := tgbotapi.NewMessage(u.ChatID, "cover "+u.Params["id"])
+		photo := tgbotapi.NewPhoto(u.ChatID, tgbotapi.FileID("cover-"+u.Params["id"]))
+		res := &handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{&caption},
+		}
+		return res.Send(
+			tgbotapi.NewChatAction(u.ChatID, tgbotapi.ChatUploadPhoto),
+			photo,
+			tgbotapi.NewDeleteMessage(u.ChatID, u.Message.MessageID),
+		), nil
+	})
+	return bot
+}
+
+func TestServeWithTestServer(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBot(t, server)
+
+	served := make(chan error)
+	go func() {
+		served <- bot.Serve(context.Background())
+	}()
+
+	server.PushMessage(1, 1, "/start")
+	server.PushMessage(1, 1, "John")
+	server.PushCallback(2, 2, 10, "/books/42")
+	server.PushMessage(-100, 3, "hi")
+
+	requests, err := server.WaitForRequests("sendMessage", 4, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bot.Shutdown(context.Background()); err != nil {
+		t.Errorf("we didn't expect error on shutdown but we got %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("we didn't expect error from serve but we got %v", err)
+	}
+
+	got := make(map[int64][]string)
+	for _, request := range requests {
+		got[request.ChatID()] = append(got[request.ChatID()], request.Text())
+	}
+
+	for chatID, texts := range map[int64][]string{
+		1:    {"what is your name?", "hello John"},
+		2:    {"book 42"},
+		-100: {"root"},
+	} {
+		if strings.Join(got[chatID], ",") != strings.Join(texts, ",") {
+			t.Errorf("we expected %v in chat %d but we got %v", texts, chatID, got[chatID])
+		}
+	}
+}
+
+func TestServeSkipsBadUpdates(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBot(t, server)
+
+	served := make(chan error)
+	go func() {
+		served <- bot.Serve(context.Background())
+	}()
+
+	server.PushRawUpdate([]byte(`{"message":{"message_id":"not a number","chat":{"id":1,"type":"private"}}}`))
+	server.PushMessage(1, 1, "/books/7")
+
+	requests, err := server.WaitForRequests("sendMessage", 1, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bot.Shutdown(context.Background()); err != nil {
+		t.Errorf("we didn't expect error on shutdown but we got %v", err)
+	}
+	<-served
+
+	if requests[0].Text() != "book 7" {
+		t.Errorf("we expected the update after the bad one be handled but we got %s", requests[0].Text())
+	}
+}
+
+func TestWebhookWithTestServer(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBot(t, server)
+	webhookHandler := bot.WebhookHandler("secret")
+
+	for i, testCase := range []struct {
+		secretToken  string
+		body         string
+		expectedCode int
+	}{
+		{
+			secretToken:  "wrong",
+			body:         `{"update_id":1,"message":{"message_id":1,"text":"/books/1","from":{"id":5},"chat":{"id":5,"type":"private"}}}`,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			secretToken:  "secret",
+			body:         `{"update_id":2,"message":{"message_id":2,"text":"/books/2","from":{"id":5},"chat":{"id":5,"type":"private"}}}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			secretToken:  "secret",
+			body:         `{"update_id":4,"message":"/books/4"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			secretToken:  "secret",
+			body:         `[{"update_id":5}]`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			secretToken:  "secret",
+			body:         `not an update`,
+			expectedCode: http.StatusBadRequest,
+		},
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testCase.body))
+		request.Header.Set("X-Telegram-Bot-Api-Secret-Token", testCase.secretToken)
+		recorder := httptest.NewRecorder()
+
+		webhookHandler.ServeHTTP(recorder, request)
+
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("we expected status %d at %d but we got %d", testCase.expectedCode, i, recorder.Code)
+		}
+	}
+
+	requests, err := server.WaitForRequests("sendMessage", 1, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 || requests[0].Text() != "book 2" || requests[0].ChatID() != 5 {
+		t.Errorf("we expected only book 2 be sent to chat 5 but we got %+v", requests)
+	}
+
+	bot.dispatcher.Shutdown(context.Background())
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"update_id":3,"message":{"message_id":3,"text":"/books/3","from":{"id":5},"chat":{"id":5,"type":"private"}}}`))
+	request.Header.Set("X-Telegram-Bot-Api-Secret-Token", "secret")
+	recorder := httptest.NewRecorder()
+
+	webhookHandler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("we expected status %d once stopped but we got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+}
+
+func TestStartWebhook(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBotWithOptions(t, server, &TeleCraftOptions{OutboxPath: filepath.Join(t.TempDir(), "outbox.jsonl")})
+	webhookOptions := &WebhookOptions{URL: "https://bot.example.com/telegram"}
+
+	if err := bot.ServeWebhook(context.Background(), nil); err == nil {
+		t.Error("we expected an error for the nil options of ServeWebhook")
+	}
+	if err := bot.StartWebhook(context.Background(), nil); err == nil {
+		t.Error("we expected an error for the nil options of StartWebhook")
+	}
+
+	server.Fail("setWebhook", http.StatusBadRequest, "Bad Request: bad webhook", 0)
+	if err := bot.StartWebhook(context.Background(), webhookOptions); err == nil {
+		t.Fatal("we expected an error when the webhook can't be registered")
+	}
+	select {
+	case <-bot.outbox.stopped:
+	default:
+		t.Fatal("we expected the outbox be stopped when the webhook can't be registered")
+	}
+
+	if err := bot.StartWebhook(context.Background(), webhookOptions); err != nil {
+		t.Fatalf("we didn't expect error on starting again but we got %v", err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(`{"update_id":1,"message":{"message_id":1,"text":"/root","from":{"id":5},"chat":{"id":5,"type":"private"}}}`))
+	recorder := httptest.NewRecorder()
+	bot.WebhookHandler("").ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("we expected status %d but we got %d", http.StatusOK, recorder.Code)
+	}
+
+	if _, err := server.WaitForRequests("sendMessage", 1, 2*time.Second); err != nil {
+		t.Fatalf("we expected the reply be delivered through the outbox: %v", err)
+	}
+	if err := bot.Shutdown(context.Background()); err != nil {
+		t.Fatalf("we didn't expect error on shutdown but we got %v", err)
+	}
+
+	if registered := server.Requests("setWebhook"); len(registered) != 2 {
+		t.Errorf("we expected the webhook be registered twice but we got %d", len(registered))
+	}
+	if deleted := server.Requests("deleteWebhook"); len(deleted) != 1 {
+		t.Errorf("we expected the webhook be deleted once but we got %d", len(deleted))
+	}
+}
+
+func TestSendChattables(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBot(t, server)
+
+	served := make(chan error)
+	go func() {
+		served <- bot.Serve(context.Background())
+	}()
+
+	server.PushMessage(7, 7, "/cover/3")
+
+	requests, err := server.WaitForRequests("", 4, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.Shutdown(context.Background())
+	<-served
+
+	for i, method := range []string{"sendMessage", "sendChatAction", "sendPhoto", "deleteMessage"} {
+		if requests[i].Method != method {
+			t.Errorf("we expected %s at %d but we got %s", method, i, requests[i].Method)
+		}
+		if requests[i].ChatID() != 7 {
+			t.Errorf("we expected chat 7 at %d but we got %d", i, requests[i].ChatID())
+		}
+	}
+	if photo := requests[2].Params.Get("photo"); photo != "cover-3" {
+		t.Errorf("we expected photo cover-3 but we got %s", photo)
+	}
+}
+
+func TestAnswerCallback(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBot(t, server)
+	bot.Router.Register("vote", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		return &handler.ResponseHandlerFunc{
+			CallbackAnswer: &handler.CallbackAnswer{Text: "thanks", ShowAlert: true, CacheTime: 5},
+		}, nil
+	})
+	bot.Router.Register("self", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		callback := tgbotapi.NewCallback(u.CallbackQuery.ID, "by the handler")
+		res := &handler.ResponseHandlerFunc{}
+		return res.Send(callback), nil
+	})
+
+	served := make(chan error)
+	go func() {
+		served <- bot.Serve(context.Background())
+	}()
+
+	server.PushCallback(1, 1, 1, "/vote")
+	server.PushCallback(2, 2, 2, "/books/7")
+	server.PushCallback(3, 3, 3, "/self")
+
+	requests, err := server.WaitForRequests("answerCallbackQuery", 3, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.WaitForRequests("sendMessage", 1, 3*time.Second)
+	bot.Shutdown(context.Background())
+	<-served
+
+	answers := make(map[string]url.Values)
+	for _, request := range server.Requests("answerCallbackQuery") {
+		answers[request.Params.Get("callback_query_id")] = request.Params
+	}
+	if len(requests) != 3 || len(answers) != 3 {
+		t.Fatalf("we expected one answer per query but we got %d", len(server.Requests("answerCallbackQuery")))
+	}
+
+	for id, expected := range map[string]struct {
+		text      string
+		showAlert string
+		cacheTime string
+	}{
+		"callback-1": {text: "thanks", showAlert: "true", cacheTime: "5"},
+		"callback-2": {text: "", showAlert: "", cacheTime: ""},
+		"callback-3": {text: "by the handler", showAlert: "", cacheTime: ""},
+	} {
+		params := answers[id]
+		if params.Get("text") != expected.text || params.Get("show_alert") != expected.showAlert || params.Get("cache_time") != expected.cacheTime {
+			t.Errorf("we expected %+v for %s but we got %v", expected, id, params)
+		}
+	}
+}
+
+func TestReplyBusy(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBotWithOptions(t, server, &TeleCraftOptions{BusyMessage: "busy"})
+
+	bot.replyBusy(handler.NewContext(&tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      "callback-1",
+			From:    &tgbotapi.User{ID: 1},
+			Message: &tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: 1, Type: "private"}},
+			Data:    "/vote",
+		},
+	}))
+	bot.replyBusy(handler.NewContext(&tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			Text: "hi",
+			From: &tgbotapi.User{ID: 2},
+			Chat: &tgbotapi.Chat{ID: 2, Type: "private"},
+		},
+	}))
+
+	answers := server.Requests("answerCallbackQuery")
+	if len(answers) != 1 || answers[0].Params.Get("text") != "busy" {
+		t.Errorf("we expected the query be answered busy but we got %+v", answers)
+	}
+	messages := server.Requests("sendMessage")
+	if len(messages) != 1 || messages[0].ChatID() != 2 {
+		t.Errorf("we expected busy be sent only to the chat of the message but we got %+v", messages)
+	}
+}
+
+func TestReplyBadRequest(t *testing.T) {
+	server := telecrafttest.NewServer()
+	defer server.Close()
+
+	bot := newTestBotWithOptions(t, server, &TeleCraftOptions{ErrorMessage: "something went wrong"})
+	bot.Router.Register("adult/:age", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		var form struct {
+			Age int `param:"age" validate:"min=18"`
+		}
+		if err := u.Bind(&form); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("the database is down")
+	})
+	bot.Router.Register("page/:number", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		_, err := u.ParamInt("number")
+		return nil, err
+	})
+	bot.Router.Register("wrapped", func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		err := telecrafterror.Scope("test").BadRequest().UserFacing().Errorf("send it again")
+		return nil, telecrafterror.Wrap(err).Errorf("the row 5 is locked")
+	})
+
+	for i, testCase := range []struct {
+		text     string
+		expected string
+	}{
+		{text: "/adult/12", expected: "age must be at least 18"},
+		{text: "/adult/30", expected: "something went wrong"},
+		{text: "/page/two", expected: "something went wrong"},
+		{text: "/wrapped", expected: "send it again"},
+	} {
+		before := len(server.Requests("sendMessage"))
+		bot.handleRequest(handler.NewContext(&tgbotapi.Update{Message: &tgbotapi.Message{
+			Text: testCase.text,
+			From: &tgbotapi.User{ID: 1},
+			Chat: &tgbotapi.Chat{ID: 1, Type: "private"},
+		}}))
+
+		requests := server.Requests("sendMessage")[before:]
+		if len(requests) == 0 || requests[0].Text() != testCase.expected {
+			t.Errorf("we expected %s at %d but we got %+v", testCase.expected, i, requests)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package telecrafttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	Token    = "123456:telecrafttest"
+	BotID    = 123456
+	BotName  = "telecraft_test_bot"
+	maxPoll  = time.Second
+	pathBase = "/bot"
+)
+
+// Request is a call the bot has made to the server.
+type Request struct {
+	Method string
+	Params url.Values
+}
+
+func (r Request) ChatID() int64 {
+	chatID, _ := strconv.ParseInt(r.Params.Get("chat_id"), 10, 64)
+	return chatID
+}
+
+func (r Request) Text() string {
+	return r.Params.Get("text")
+}
+
+type failure struct {
+	code        int
+	description string
+	retryAfter  int
+}
+
+// Server emulates the endpoints of the Bot API the framework uses. Updates
+// pushed to it are served by getUpdates, and every other call is recorded and
+// answered with a plausible result.
+type Server struct {
+	server        *httptest.Server
+	mutex         sync.Mutex
+	updates       []json.RawMessage
+	updateIDs     []int
+	nextUpdateID  int
+	nextMessageID int
+	requests      []Request
+	failures      map[string][]failure
+	notify        chan struct{}
+}
+
+func NewServer() *Server {
+	s := &Server{
+		nextUpdateID:  1,
+		nextMessageID: 1,
+		failures:      make(map[string][]failure),
+		notify:        make(chan struct{}),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// APIEndpoint is meant for TeleCraftOptions.APIEndpoint together with Token.
+func (s *Server) APIEndpoint() string {
+	return s.server.URL + pathBase + "%s/%s"
+}
+
+// PushUpdate queues an update for getUpdates and returns its update id.
+func (s *Server) PushUpdate(update tgbotapi.Update) int {
+	s.mutex.Lock()
+	update.UpdateID = s.nextUpdateID
+	s.mutex.Unlock()
+
+	raw, _ := json.Marshal(update)
+	return s.PushRawUpdate(raw)
+}
+
+// PushRawUpdate queues an update given as JSON, for fields tgbotapi lacks; its
+// update_id is overwritten.
+func (s *Server) PushRawUpdate(raw []byte) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var update map[string]any
+	json.Unmarshal(raw, &update)
+
+	updateID := s.nextUpdateID
+	s.nextUpdateID++
+	update["update_id"] = updateID
+
+	raw, _ = json.Marshal(update)
+	s.updates = append(s.updates, raw)
+	s.updateIDs = append(s.updateIDs, updateID)
+
+	close(s.notify)
+	s.notify = make(chan struct{})
+	return updateID
+}
+
+func (s *Server) PushMessage(chatID int64, userID int64, text string) int {
+	return s.PushUpdate(tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			MessageID: s.newMessageID(),
+			From:      &tgbotapi.User{ID: userID},
+			Chat:      newChat(chatID),
+			Date:      int(time.Now().Unix()),
+			Text:      text,
+		},
+	})
+}
+
+// PushCallback queues the press of an inline button under message messageID.
+func (s *Server) PushCallback(chatID int64, userID int64, messageID int, data string) int {
+	return s.PushUpdate(tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:   fmt.Sprintf("callback-%d", messageID),
+			From: &tgbotapi.User{ID: userID},
+			Message: &tgbotapi.Message{
+				MessageID: messageID,
+				From:      &tgbotapi.User{ID: BotID, IsBot: true, UserName: BotName},
+				Chat:      newChat(chatID),
+			},
+			Data: data,
+		},
+	})
+}
+
+func newChat(chatID int64) *tgbotapi.Chat {
+	if chatID < 0 {
+		return &tgbotapi.Chat{ID: chatID, Type: "supergroup"}
+	}
+	return &tgbotapi.Chat{ID: chatID, Type: "private"}
+}
+
+// Fail makes the next call of method answer with an error. retryAfter fills
+// parameters.retry_after when it is positive.
+func (s *Server) Fail(method string, code int, description string, retryAfter int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failures[method] = append(s.failures[method], failure{
+		code:        code,
+		description: description,
+		retryAfter:  retryAfter,
+	})
+}
+
+// Requests returns the recorded calls of method, or of every method except
+// getUpdates and getMe when method is empty.
+func (s *Server) Requests(method string) []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	requests := []Request{}
+	for _, request := range s.requests {
+		if request.Method == method || (len(method) == 0 && request.Method != "getUpdates" && request.Method != "getMe") {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// WaitForRequests waits until method has been called n times.
+func (s *Server) WaitForRequests(method string, n int, timeout time.Duration) ([]Request, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		requests := s.Requests(method)
+		if len(requests) >= n {
+			return requests, nil
+		}
+		if time.Now().After(deadline) {
+			return requests, fmt.Errorf("we expected %d calls of %s but we got %d", n, method, len(requests))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (s *Server) newMessageID() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messageID := s.nextMessageID
+	s.nextMessageID++
+	return messageID
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	token, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, pathBase), "/")
+	if !ok || token != Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", 0)
+		return
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.ParseMultipartForm(32 << 20)
+	} else {
+		r.ParseForm()
+	}
+	params := r.Form
+
+	s.mutex.Lock()
+	if method != "getUpdates" {
+		s.requests = append(s.requests, Request{Method: method, Params: params})
+	}
+	if failures := s.failures[method]; len(failures) > 0 {
+		s.failures[method] = failures[1:]
+		s.mutex.Unlock()
+		writeError(w, failures[0].code, failures[0].description, failures[0].retryAfter)
+		return
+	}
+	s.mutex.Unlock()
+
+	switch method {
+	case "getMe":
+		writeResult(w, tgbotapi.User{ID: BotID, IsBot: true, UserName: BotName})
+	case "getUpdates":
+		s.getUpdates(w, params)
+	case "sendMessage", "sendPhoto", "sendDocument", "sendSticker", "sendLocation", "sendPoll",
+		"sendAudio", "sendVideo", "sendVoice", "sendAnimation", "sendContact", "sendVenue", "sendDice":
+		writeResult(w, s.newMessage(params))
+	case "editMessageText", "editMessageReplyMarkup", "editMessageCaption":
+		writeResult(w, s.editedMessage(params))
+	case "getFile":
+		fileID := params.Get("file_id")
+		writeResult(w, tgbotapi.File{FileID: fileID, FilePath: "files/" + fileID})
+	default:
+		writeResult(w, true)
+	}
+}
+
+func (s *Server) getUpdates(w http.ResponseWriter, params url.Values) {
+	offset, _ := strconv.Atoi(params.Get("offset"))
+	timeout, _ := strconv.Atoi(params.Get("timeout"))
+
+	wait := time.Duration(timeout) * time.Second
+	if wait > maxPoll {
+		wait = maxPoll
+	}
+	deadline := time.After(wait)
+
+	for {
+		s.mutex.Lock()
+		batch := []json.RawMessage{}
+		for i, raw := range s.updates {
+			if s.updateIDs[i] >= offset {
+				batch = append(batch, raw)
+			}
+		}
+		notify := s.notify
+		s.mutex.Unlock()
+
+		if len(batch) > 0 {
+			writeResult(w, batch)
+			return
+		}
+
+		select {
+		case <-notify:
+		case <-deadline:
+			writeResult(w, batch)
+			return
+		}
+	}
+}
+
+func (s *Server) newMessage(params url.Values) tgbotapi.Message {
+	chatID, _ := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	return tgbotapi.Message{
+		MessageID: s.newMessageID(),
+		From:      &tgbotapi.User{ID: BotID, IsBot: true, UserName: BotName},
+		Chat:      newChat(chatID),
+		Date:      int(time.Now().Unix()),
+		Text:      params.Get("text"),
+	}
+}
+
+func (s *Server) editedMessage(params url.Values) tgbotapi.Message {
+	chatID, _ := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	messageID, _ := strconv.Atoi(params.Get("message_id"))
+	return tgbotapi.Message{
+		MessageID: messageID,
+		From:      &tgbotapi.User{ID: BotID, IsBot: true, UserName: BotName},
+		Chat:      newChat(chatID),
+		Date:      int(time.Now().Unix()),
+		Text:      params.Get("text"),
+	}
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	raw, _ := json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: raw})
+}
+
+func writeError(w http.ResponseWriter, code int, description string, retryAfter int) {
+	response := tgbotapi.APIResponse{Ok: false, ErrorCode: code, Description: description}
+	if retryAfter > 0 {
+		response.Parameters = &tgbotapi.ResponseParameters{RetryAfter: retryAfter}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,40 @@
+package tree
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/mohamadrezamomeni/telecraft/pkg/utils"
+)
+
+// Constraint tells whether a parameter value is acceptable for a route.
+type Constraint = func(value string) bool
+
+var (
+	constraintsMutex sync.RWMutex
+	constraints      = map[string]Constraint{
+		"int": func(value string) bool {
+			_, err := strconv.ParseInt(value, 10, 64)
+			return err == nil
+		},
+		"uuid": utils.IsUUID,
+	}
+)
+
+// RegisterConstraint makes name usable as a type in route patterns, like
+// :code<lang>. It has to be called before the routes using it are registered;
+// an unknown name is taken as a regular expression.
+func RegisterConstraint(name string, constraint Constraint) {
+	constraintsMutex.Lock()
+	defer constraintsMutex.Unlock()
+
+	constraints[name] = constraint
+}
+
+func constraintOf(name string) (Constraint, bool) {
+	constraintsMutex.RLock()
+	defer constraintsMutex.RUnlock()
+
+	constraint, ok := constraints[name]
+	return constraint, ok
+}
@@ -0,0 +1,86 @@
+package tree
+
+import (
+	"regexp"
+	"strings"
+)
+
+type segmentKind int
+
+const (
+	staticSegment segmentKind = iota
+	paramSegment
+	catchAllSegment
+)
+
+// segment is a part of a route pattern: a static one like books, a parameter
+// like :id, or a catch-all like *rest taking the rest of the path. Parameters
+// and catch-alls may be constrained, like :id<int> or :slug<[a-z-]+>, and
+// ending with ? makes them optional.
+type segment struct {
+	kind       segmentKind
+	name       string
+	constraint string
+	matches    Constraint
+	optional   bool
+}
+
+func parseSegment(path string) (segment, error) {
+	s := segment{name: path}
+
+	switch {
+	case strings.HasPrefix(path, ":"):
+		s.kind = paramSegment
+	case strings.HasPrefix(path, "*"):
+		s.kind = catchAllSegment
+	default:
+		return s, nil
+	}
+
+	s.name = path[1:]
+	if strings.HasSuffix(s.name, "?") {
+		s.name = strings.TrimSuffix(s.name, "?")
+		s.optional = true
+	}
+
+	start := strings.IndexByte(s.name, '<')
+	if start < 0 || !strings.HasSuffix(s.name, ">") {
+		return s, nil
+	}
+	s.constraint = s.name[start+1 : len(s.name)-1]
+	s.name = s.name[:start]
+
+	if constraint, ok := constraintOf(s.constraint); ok {
+		s.matches = constraint
+		return s, nil
+	}
+	pattern, err := regexp.Compile("^(?:" + s.constraint + ")$")
+	if err != nil {
+		return s, err
+	}
+	s.matches = pattern.MatchString
+	return s, nil
+}
+
+func mustParseSegment(path string) segment {
+	s, err := parseSegment(path)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s segment) accepts(value string) bool {
+	return s.matches == nil || s.matches(value)
+}
+
+// shape is what the segment matches, regardless of its name.
+func (s segment) shape() string {
+	switch s.kind {
+	case paramSegment:
+		return ":" + s.constraint
+	case catchAllSegment:
+		return "*" + s.constraint
+	}
+	return s.name
+}
@@ -1,14 +1,29 @@
 package tree
 
 import (
+	"slices"
+	"strings"
+
 	"github.com/mohamadrezamomeni/telecraft/handler"
 	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
 )
 
+// Tree matches paths segment by segment. A segment matches a static child
+// first, then the constrained parameters accepting it and the other ones, each
+// in the order they were registered, then the catch-all; optional segments
+// are skipped last. When the rest of the path fails to match under a child,
+// the next one is tried.
 type Tree struct {
 	Handler  handler.HandlerFunc
 	path     string
+	segment  segment
+	pattern  string
 	children map[string]*Tree
+	params   []*Tree
+	catchAll *Tree
+	// shapes are what the routes registered under the root match, to find
+	// the ambiguous ones.
+	shapes map[string]string
 }
 
 func New(
@@ -18,30 +33,122 @@ func New(
 	return &Tree{
 		Handler:  handler,
 		path:     path,
+		segment:  mustParseSegment(path),
 		children: make(map[string]*Tree),
 	}
 }
 
-func (t *Tree) Set(paths []string, handler handler.HandlerFunc) {
+// Set registers handler for paths. It panics when paths is registered already
+// or matches exactly what another route does, like books/:id and books/:name,
+// or books/:id? and books.
+func (t *Tree) Set(paths []string, handler handler.HandlerFunc) *Tree {
 	scope := "tree.set"
 
+	pattern := strings.Join(paths, "/")
+	for i, path := range paths {
+		s, err := parseSegment(path)
+		if err != nil {
+			panic(
+				telecrafterror.
+					Wrap(err).
+					Scope(scope).
+					Input(pattern).
+					Errorf("the constraint of %s is invalid", path),
+			)
+		}
+		if s.kind == catchAllSegment && i < len(paths)-1 {
+			panic(
+				telecrafterror.
+					Scope(scope).
+					Input(pattern).
+					Errorf("a catch-all segment has to be the last one"),
+			)
+		}
+	}
+
+	if t.shapes == nil {
+		t.shapes = make(map[string]string)
+	}
+	shapes := shapesOf(paths)
+	for _, shape := range shapes {
+		if existing, ok := t.shapes[shape]; ok && existing == pattern {
+			panic(
+				telecrafterror.
+					Scope(scope).
+					Errorf("duplicate registration has happened"),
+			)
+		} else if ok {
+			panic(
+				telecrafterror.
+					Scope(scope).
+					Input(pattern, existing).
+					Errorf("the route is ambiguous with one registered before"),
+			)
+		}
+	}
+	for _, shape := range shapes {
+		t.shapes[shape] = pattern
+	}
+
 	cur := t
 	for _, path := range paths {
-		if child, ok := cur.children[path]; ok {
-			cur = child
-		} else {
-			cur.children[path] = New(path, nil)
-			cur = cur.children[path]
+		cur = cur.child(path)
+	}
+	cur.Handler = handler
+	cur.pattern = pattern
+	return cur
+}
+
+// child returns the child of t for path, adding it when it is new.
+// Constrained parameters are kept before the ones accepting anything.
+func (t *Tree) child(path string) *Tree {
+	switch mustParseSegment(path).kind {
+	case paramSegment:
+		for _, param := range t.params {
+			if param.path == path {
+				return param
+			}
+		}
+		param := New(path, nil)
+		i := len(t.params)
+		if param.segment.matches != nil {
+			i = slices.IndexFunc(t.params, func(p *Tree) bool { return p.segment.matches == nil })
+			if i < 0 {
+				i = len(t.params)
+			}
 		}
+		t.params = slices.Insert(t.params, i, param)
+		return param
+	case catchAllSegment:
+		if t.catchAll == nil {
+			t.catchAll = New(path, nil)
+		}
+		return t.catchAll
 	}
-	if cur.Handler != nil {
-		panic(
-			telecrafterror.
-				Scope(scope).
-				Errorf("duplicate registration has happened"),
-		)
+
+	if _, ok := t.children[path]; !ok {
+		t.children[path] = New(path, nil)
 	}
-	cur.Handler = handler
+	return t.children[path]
+}
+
+// shapesOf returns what paths match, with the names of the parameters left
+// out and a shape with and without each optional segment.
+func shapesOf(paths []string) []string {
+	shapes := []string{""}
+	for _, path := range paths {
+		s := mustParseSegment(path)
+
+		next := []string{}
+		for _, shape := range shapes {
+			next = append(next, shape+"/"+s.shape())
+			if s.optional {
+				next = append(next, shape)
+			}
+		}
+		shapes = next
+	}
+	return shapes
 }
 
 func (t *Tree) MatchPath(paths []string) (*Tree, map[string]string) {
@@ -52,24 +159,50 @@ func (t *Tree) matchPathRecursive(paths []string, i int) (*Tree, map[string]stri
 	if i >= len(paths) && t.Handler != nil {
 		return t, make(map[string]string)
 	} else if i >= len(paths) {
-		return nil, nil
+		return t.skipOptional(paths, i)
 	}
 
 	curPath := paths[i]
 
-	var res *Tree
-	var params map[string]string
-	for subPath, child := range t.children {
-		if subPath == curPath || (len(subPath) > 0 && subPath[0] == ':') {
-			res, params = child.matchPathRecursive(paths, i+1)
+	if child, ok := t.children[curPath]; ok {
+		if res, params := child.matchPathRecursive(paths, i+1); res != nil {
+			return res, params
+		}
+	}
+
+	for _, child := range t.params {
+		if !child.segment.accepts(curPath) {
+			continue
 		}
-		if params != nil && len(subPath) > 0 && subPath[0] == ':' {
-			params[subPath[1:]] = curPath
+		if res, params := child.matchPathRecursive(paths, i+1); res != nil {
+			params[child.segment.name] = curPath
+			return res, params
 		}
-		if res != nil {
+	}
+
+	if t.catchAll != nil && t.catchAll.Handler != nil && t.catchAll.segment.accepts(strings.Join(paths[i:], "/")) {
+		params := make(map[string]string)
+		params[t.catchAll.segment.name] = strings.Join(paths[i:], "/")
+		return t.catchAll, params
+	}
+
+	return t.skipOptional(paths, i)
+}
+
+// skipOptional matches the rest of paths as if an optional child of t was
+// left out.
+func (t *Tree) skipOptional(paths []string, i int) (*Tree, map[string]string) {
+	for _, child := range t.params {
+		if !child.segment.optional {
+			continue
+		}
+		if res, params := child.matchPathRecursive(paths, i); res != nil {
 			return res, params
 		}
 	}
 
+	if t.catchAll != nil && t.catchAll.segment.optional && i >= len(paths) {
+		return t.catchAll, make(map[string]string)
+	}
 	return nil, nil
 }
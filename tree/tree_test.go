@@ -196,3 +196,351 @@ func TestResovingHandler(t *testing.T) {
 		}
 	}
 }
+
+func textHandler(text string) handler.HandlerFunc {
+	return func(u *handler.Context) (*handler.ResponseHandlerFunc, error) {
+		return &handler.ResponseHandlerFunc{
+			MessageConfigs: []*tgbotapi.MessageConfig{
+				{Text: text},
+			},
+		}, nil
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	root := New("", nil)
+
+	root.Set(strings.Split("users/:id", "/"), textHandler("user"))
+	root.Set(strings.Split("users/me", "/"), textHandler("me"))
+	root.Set(strings.Split("users/me/settings", "/"), textHandler("settings"))
+	root.Set(strings.Split("users/:id/books", "/"), textHandler("books"))
+	root.Set(strings.Split("users/:name/friends", "/"), textHandler("friends"))
+
+	for i, testCase := range []struct {
+		input       string
+		params      map[string]string
+		handlertext string
+	}{
+		{
+			input:       "users/me",
+			params:      map[string]string{},
+			handlertext: "me",
+		},
+		{
+			input:       "users/42",
+			params:      map[string]string{"id": "42"},
+			handlertext: "user",
+		},
+		{
+			input:       "users/me/settings",
+			params:      map[string]string{},
+			handlertext: "settings",
+		},
+		{
+			input:       "users/me/books",
+			params:      map[string]string{"id": "me"},
+			handlertext: "books",
+		},
+		{
+			input:       "users/me/friends",
+			params:      map[string]string{"name": "me"},
+			handlertext: "friends",
+		},
+	} {
+		// the children were kept in a map, so a wrong order showed up only
+		// in some of the runs
+		for run := 0; run < 20; run++ {
+			node, params := root.MatchPath(strings.Split(testCase.input, "/"))
+			if node == nil {
+				t.Fatalf("we expected %s be matched at %d but we got nothing", testCase.input, i)
+			}
+
+			res, _ := node.Handler(&handler.Context{})
+			if text := res.MessageConfigs[0].Text; text != testCase.handlertext {
+				t.Fatalf("we expected %s at %d but we got %s", testCase.handlertext, i, text)
+			}
+			if len(params) != len(testCase.params) {
+				t.Fatalf("we expected params %v at %d but we got %v", testCase.params, i, params)
+			}
+			for k, v := range testCase.params {
+				if params[k] != v {
+					t.Fatalf("we expected params %v at %d but we got %v", testCase.params, i, params)
+				}
+			}
+		}
+	}
+}
+
+func TestAmbiguousRoutes(t *testing.T) {
+	for i, testCase := range []struct {
+		registered []string
+		path       string
+		panics     bool
+	}{
+		{
+			registered: []string{"books/:id"},
+			path:       "books/:name",
+			panics:     true,
+		},
+		{
+			registered: []string{"books/:id/authors"},
+			path:       "books/:name/authors",
+			panics:     true,
+		},
+		{
+			registered: []string{"books/:id"},
+			path:       "books/:id",
+			panics:     true,
+		},
+		{
+			registered: []string{"books/:id/authors"},
+			path:       "books/:name/covers",
+		},
+		{
+			registered: []string{"books/:id"},
+			path:       "books/latest",
+		},
+		{
+			registered: []string{"books/:id/authors"},
+			path:       "books/:name",
+		},
+		{
+			registered: []string{"books"},
+			path:       "books/:id?",
+			panics:     true,
+		},
+		{
+			registered: []string{"books/:id?"},
+			path:       "books/:name",
+			panics:     true,
+		},
+		{
+			registered: []string{"menu/*path"},
+			path:       "menu/*rest?",
+			panics:     true,
+		},
+		{
+			registered: []string{"menu/:id"},
+			path:       "menu/*path",
+		},
+		{
+			registered: []string{},
+			path:       "menu/*path/settings",
+			panics:     true,
+		},
+		{
+			registered: []string{"books/:id<int>"},
+			path:       "books/:number<int>",
+			panics:     true,
+		},
+		{
+			registered: []string{"books/:id<int>"},
+			path:       "books/:slug<[a-z-]+>",
+		},
+		{
+			registered: []string{},
+			path:       "books/:slug<[a-z>",
+			panics:     true,
+		},
+	} {
+		root := New("", nil)
+		for _, path := range testCase.registered {
+			root.Set(strings.Split(path, "/"), textHandler(path))
+		}
+
+		panicked := func() (panicked bool) {
+			defer func() {
+				panicked = recover() != nil
+			}()
+			root.Set(strings.Split(testCase.path, "/"), textHandler(testCase.path))
+			return false
+		}()
+
+		if panicked != testCase.panics {
+			t.Errorf("we expected the registration of %s to panic be %v but we got %v at %d", testCase.path, testCase.panics, panicked, i)
+		}
+	}
+}
+
+func TestCatchAllAndOptional(t *testing.T) {
+	root := New("", nil)
+
+	root.Set(strings.Split("books/:id?", "/"), textHandler("books"))
+	root.Set(strings.Split("books/:id/cover", "/"), textHandler("cover"))
+	root.Set(strings.Split("menu/*path", "/"), textHandler("menu"))
+	root.Set(strings.Split("files/*path?", "/"), textHandler("files"))
+	root.Set(strings.Split("shop/:category?/items", "/"), textHandler("items"))
+
+	for i, testCase := range []struct {
+		input       string
+		isExisted   bool
+		params      map[string]string
+		handlertext string
+	}{
+		{
+			input:       "books",
+			isExisted:   true,
+			params:      map[string]string{},
+			handlertext: "books",
+		},
+		{
+			input:       "books/7",
+			isExisted:   true,
+			params:      map[string]string{"id": "7"},
+			handlertext: "books",
+		},
+		{
+			input:       "books/7/cover",
+			isExisted:   true,
+			params:      map[string]string{"id": "7"},
+			handlertext: "cover",
+		},
+		{
+			input:       "menu/settings/language/fa",
+			isExisted:   true,
+			params:      map[string]string{"path": "settings/language/fa"},
+			handlertext: "menu",
+		},
+		{
+			input: "menu",
+		},
+		{
+			input:       "files",
+			isExisted:   true,
+			params:      map[string]string{},
+			handlertext: "files",
+		},
+		{
+			input:       "files/a/b",
+			isExisted:   true,
+			params:      map[string]string{"path": "a/b"},
+			handlertext: "files",
+		},
+		{
+			input:       "shop/items",
+			isExisted:   true,
+			params:      map[string]string{},
+			handlertext: "items",
+		},
+		{
+			input:       "shop/toys/items",
+			isExisted:   true,
+			params:      map[string]string{"category": "toys"},
+			handlertext: "items",
+		},
+		{
+			input: "shop/toys",
+		},
+	} {
+		node, params := root.MatchPath(strings.Split(testCase.input, "/"))
+		if (node != nil) != testCase.isExisted {
+			t.Errorf("we expected %s be matched be %v at %d", testCase.input, testCase.isExisted, i)
+			continue
+		}
+		if node == nil {
+			continue
+		}
+
+		res, _ := node.Handler(&handler.Context{})
+		if text := res.MessageConfigs[0].Text; text != testCase.handlertext {
+			t.Errorf("we expected %s at %d but we got %s", testCase.handlertext, i, text)
+		}
+		if len(params) != len(testCase.params) {
+			t.Errorf("we expected params %v at %d but we got %v", testCase.params, i, params)
+		}
+		for k, v := range testCase.params {
+			if params[k] != v {
+				t.Errorf("we expected params %v at %d but we got %v", testCase.params, i, params)
+			}
+		}
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	RegisterConstraint("lang", func(value string) bool {
+		return value == "en" || value == "fa"
+	})
+
+	root := New("", nil)
+
+	root.Set(strings.Split("books/:slug", "/"), textHandler("slug"))
+	root.Set(strings.Split("books/:id<int>", "/"), textHandler("id"))
+	root.Set(strings.Split("orders/:id<uuid>", "/"), textHandler("order"))
+	root.Set(strings.Split("tags/:tag<[a-z-]+>", "/"), textHandler("tag"))
+	root.Set(strings.Split("settings/:code<lang>?", "/"), textHandler("settings"))
+
+	for i, testCase := range []struct {
+		input       string
+		isExisted   bool
+		params      map[string]string
+		handlertext string
+	}{
+		{
+			input:       "books/42",
+			isExisted:   true,
+			params:      map[string]string{"id": "42"},
+			handlertext: "id",
+		},
+		{
+			input:       "books/go-in-action",
+			isExisted:   true,
+			params:      map[string]string{"slug": "go-in-action"},
+			handlertext: "slug",
+		},
+		{
+			input:       "orders/4F3C2A10-9B7D-4E21-8C55-0D6E1F2A3B4C",
+			isExisted:   true,
+			params:      map[string]string{"id": "4F3C2A10-9B7D-4E21-8C55-0D6E1F2A3B4C"},
+			handlertext: "order",
+		},
+		{
+			input: "orders/42",
+		},
+		{
+			input:       "tags/new-books",
+			isExisted:   true,
+			params:      map[string]string{"tag": "new-books"},
+			handlertext: "tag",
+		},
+		{
+			input: "tags/New",
+		},
+		{
+			input:       "settings/fa",
+			isExisted:   true,
+			params:      map[string]string{"code": "fa"},
+			handlertext: "settings",
+		},
+		{
+			input:       "settings",
+			isExisted:   true,
+			params:      map[string]string{},
+			handlertext: "settings",
+		},
+		{
+			input: "settings/de",
+		},
+	} {
+		node, params := root.MatchPath(strings.Split(testCase.input, "/"))
+		if (node != nil) != testCase.isExisted {
+			t.Errorf("we expected %s be matched be %v at %d", testCase.input, testCase.isExisted, i)
+			continue
+		}
+		if node == nil {
+			continue
+		}
+
+		res, _ := node.Handler(&handler.Context{})
+		if text := res.MessageConfigs[0].Text; text != testCase.handlertext {
+			t.Errorf("we expected %s at %d but we got %s", testCase.handlertext, i, text)
+		}
+		if len(params) != len(testCase.params) {
+			t.Errorf("we expected params %v at %d but we got %v", testCase.params, i, params)
+		}
+		for k, v := range testCase.params {
+			if params[k] != v {
+				t.Errorf("we expected params %v at %d but we got %v", testCase.params, i, params)
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package telecraft
+
+import (
+	"encoding/json"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/handler"
+)
+
+type topicMessage struct {
+	MessageThreadID int  `json:"message_thread_id"`
+	IsTopicMessage  bool `json:"is_topic_message"`
+}
+
+// topicEnvelope picks the forum topic of an update, which the types of
+// tgbotapi don't carry.
+type topicEnvelope struct {
+	Message       *topicMessage `json:"message"`
+	EditedMessage *topicMessage `json:"edited_message"`
+	CallbackQuery *struct {
+		Message *topicMessage `json:"message"`
+	} `json:"callback_query"`
+}
+
+func (e *topicEnvelope) threadID() int {
+	var message *topicMessage
+	switch {
+	case e.Message != nil:
+		message = e.Message
+	case e.EditedMessage != nil:
+		message = e.EditedMessage
+	case e.CallbackQuery != nil:
+		message = e.CallbackQuery.Message
+	}
+
+	if message == nil || !message.IsTopicMessage {
+		return 0
+	}
+	return message.MessageThreadID
+}
+
+func decodeUpdate(data []byte) (*handler.Context, error) {
+	var update tgbotapi.Update
+	if err := json.Unmarshal(data, &update); err != nil {
+		return nil, err
+	}
+
+	var envelope topicEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+
+	context := handler.NewContext(&update)
+	context.MessageThreadID = envelope.threadID()
+	return context, nil
+}
@@ -0,0 +1,45 @@
+package telecraft
+
+import "testing"
+
+func TestDecodeUpdate(t *testing.T) {
+	for i, testCase := range []struct {
+		input    string
+		threadID int
+		chatID   int64
+		userID   string
+	}{
+		{
+			input:    `{"update_id":1,"message":{"message_id":5,"message_thread_id":12,"is_topic_message":true,"from":{"id":3},"chat":{"id":-100,"type":"supergroup"},"text":"hi"}}`,
+			threadID: 12,
+			chatID:   -100,
+			userID:   "3",
+		},
+		{
+			input:    `{"update_id":2,"message":{"message_id":5,"message_thread_id":4,"from":{"id":3},"chat":{"id":-100,"type":"supergroup"},"text":"reply"}}`,
+			threadID: 0,
+			chatID:   -100,
+			userID:   "3",
+		},
+		{
+			input:    `{"update_id":3,"callback_query":{"id":"q","from":{"id":3},"data":"/menu","message":{"message_id":9,"message_thread_id":8,"is_topic_message":true,"chat":{"id":-100,"type":"supergroup"}}}}`,
+			threadID: 8,
+			chatID:   -100,
+			userID:   "3",
+		},
+	} {
+		context, err := decodeUpdate([]byte(testCase.input))
+		if err != nil {
+			t.Fatalf("we didn't expect error at %d but we got %v", i, err)
+		}
+		if context.MessageThreadID != testCase.threadID {
+			t.Errorf("we expected thread %d but we got %d at %d", testCase.threadID, context.MessageThreadID, i)
+		}
+		if context.ChatID != testCase.chatID {
+			t.Errorf("we expected chat %d but we got %d at %d", testCase.chatID, context.ChatID, i)
+		}
+		if context.UserID != testCase.userID {
+			t.Errorf("we expected user %s but we got %s at %d", testCase.userID, context.UserID, i)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package telecraft
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/mohamadrezamomeni/telecraft/dispatcher"
+	"github.com/mohamadrezamomeni/telecraft/pkg/telecrafterror"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+type WebhookOptions struct {
+	// URL is the public address Telegram posts updates to, e.g. https://bot.example.com/telegram.
+	URL string
+	// ListenAddr is the address the standalone server binds to, e.g. ":8443".
+	ListenAddr string
+	// Path is the route the handler is mounted on; it defaults to the path of URL.
+	Path string
+	// SecretToken is sent by Telegram in the X-Telegram-Bot-Api-Secret-Token header.
+	SecretToken string
+	// CertFile and KeyFile enable TLS on the standalone server.
+	CertFile string
+	KeyFile  string
+	// UploadCertificate sends CertFile to Telegram, needed for self-signed certificates.
+	UploadCertificate  bool
+	MaxConnections     int
+	AllowedUpdates     []string
+	DropPendingUpdates bool
+}
+
+// WebhookHandler returns an http.Handler which feeds the posted updates into the
+// same pipeline as Serve. It can be mounted on any mux; an empty secretToken
+// disables the header check. Updates rejected by a full queue are answered
+// with 429 and the ones arriving once serving has stopped with 503, so
+// Telegram delivers them again later. A body which isn't a JSON object gets
+// 400, while an update failing to decode is skipped with 200.
+func (t *TeleCraft) WebhookHandler(secretToken string) http.Handler {
+	scope := "telecraft.webhookHandler"
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !isSecretTokenValid(r.Header.Get(secretTokenHeader), secretToken) {
+			telecrafterror.Scope(scope).Forbidden().Errorf("the secret token of the webhook request is invalid")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			telecrafterror.Wrap(err).Scope(scope).Errorf("error to read the update")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !isJSONObject(body) {
+			telecrafterror.Scope(scope).BadRequest().Errorf("the body of the webhook request isn't a JSON object")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// an update failing to decode would fail again on every redelivery,
+		// so it is skipped like polling does
+		handlerContext, err := decodeUpdate(body)
+		if err != nil {
+			telecrafterror.Wrap(err).Scope(scope).BadRequest().Errorf("error to decode the update, it is skipped")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		// Telegram redelivers an update until it is answered with 2xx
+		err = t.dispatch(handlerContext)
+		switch {
+		case errors.Is(err, dispatcher.ErrQueueFull):
+			w.WriteHeader(http.StatusTooManyRequests)
+		case err != nil:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+}
+
+func isJSONObject(body []byte) bool {
+	var object map[string]json.RawMessage
+	return json.Unmarshal(body, &object) == nil && object != nil
+}
+
+func isSecretTokenValid(got, expected string) bool {
+	if len(expected) == 0 {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(expected)) == 1
+}
+
+// ServeWebhook registers the webhook on Telegram and serves it until ctx is
+// done or Shutdown is called; afterwards the webhook is deleted and in-flight
+// handlers are drained like Serve does.
+func (t *TeleCraft) ServeWebhook(ctx context.Context, webhookOptions *WebhookOptions) error {
+	scope := "telecraft.serveWebhook"
+
+	if webhookOptions == nil {
+		return telecrafterror.Scope(scope).BadRequest().Errorf("the options of webhook are missing")
+	}
+
+	path, err := webhookPath(webhookOptions)
+	if err != nil {
+		return telecrafterror.Wrap(err).Scope(scope).BadRequest().Input(webhookOptions.URL).Errorf("the url of webhook is invalid")
+	}
+
+	ctx, err = t.startWebhook(ctx, webhookOptions)
+	if err != nil {
+		return err
+	}
+	defer t.stop()
+
+	mux := http.NewServeMux()
+	mux.Handle(path, t.WebhookHandler(webhookOptions.SecretToken))
+
+	server := &http.Server{
+		Addr:    webhookOptions.ListenAddr,
+		Handler: mux,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if len(webhookOptions.CertFile) > 0 && len(webhookOptions.KeyFile) > 0 {
+			serverErr <- server.ListenAndServeTLS(webhookOptions.CertFile, webhookOptions.KeyFile)
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), t.telecraftOptions.ShutdownTimeout)
+		err = server.Shutdown(shutdownCtx)
+		cancel()
+	case err = <-serverErr:
+		err = telecrafterror.Wrap(err).Scope(scope).Errorf("the webhook server has stopped")
+	}
+
+	if stopErr := t.stopWebhook(webhookOptions); stopErr != nil && err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+// StartWebhook does what ServeWebhook does except serving, for a
+// WebhookHandler mounted on a mux of your own. It returns once the webhook is
+// registered; when ctx is done or Shutdown is called, the webhook is deleted
+// and in-flight handlers are drained in the background, and their errors are
+// logged.
+func (t *TeleCraft) StartWebhook(ctx context.Context, webhookOptions *WebhookOptions) error {
+	scope := "telecraft.startWebhook"
+
+	if webhookOptions == nil {
+		return telecrafterror.Scope(scope).BadRequest().Errorf("the options of webhook are missing")
+	}
+
+	ctx, err := t.startWebhook(ctx, webhookOptions)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer t.stop()
+
+		<-ctx.Done()
+		t.stopWebhook(webhookOptions)
+	}()
+	return nil
+}
+
+// startWebhook starts serving and registers the webhook, undoing the start
+// when the registration fails.
+func (t *TeleCraft) startWebhook(ctx context.Context, webhookOptions *WebhookOptions) (context.Context, error) {
+	ctx, err := t.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.setWebhook(webhookOptions); err != nil {
+		t.abort()
+		return nil, err
+	}
+	return ctx, nil
+}
+
+func (t *TeleCraft) stopWebhook(webhookOptions *WebhookOptions) error {
+	err := t.deleteWebhook(webhookOptions.DropPendingUpdates)
+
+	if drainErr := t.drain(); drainErr != nil && err == nil {
+		err = drainErr
+	}
+	return err
+}
+
+func webhookPath(webhookOptions *WebhookOptions) (string, error) {
+	if len(webhookOptions.Path) > 0 {
+		return webhookOptions.Path, nil
+	}
+
+	link, err := tgbotapi.NewWebhook(webhookOptions.URL)
+	if err != nil {
+		return "", err
+	}
+
+	if len(link.URL.Path) == 0 {
+		return "/", nil
+	}
+	return link.URL.Path, nil
+}
+
+func (t *TeleCraft) setWebhook(webhookOptions *WebhookOptions) error {
+	scope := "telecraft.setWebhook"
+
+	params := make(tgbotapi.Params)
+	params["url"] = webhookOptions.URL
+	params.AddNonEmpty("secret_token", webhookOptions.SecretToken)
+	params.AddNonZero("max_connections", webhookOptions.MaxConnections)
+	params.AddBool("drop_pending_updates", webhookOptions.DropPendingUpdates)
+	if len(webhookOptions.AllowedUpdates) > 0 {
+		params.AddInterface("allowed_updates", webhookOptions.AllowedUpdates)
+	}
+
+	var err error
+	if webhookOptions.UploadCertificate && len(webhookOptions.CertFile) > 0 {
+		_, err = t.bot.UploadFiles("setWebhook", params, []tgbotapi.RequestFile{
+			{Name: "certificate", Data: tgbotapi.FilePath(webhookOptions.CertFile)},
+		})
+	} else {
+		_, err = t.bot.MakeRequest("setWebhook", params)
+	}
+
+	if err != nil {
+		return telecrafterror.Wrap(err).Scope(scope).Input(webhookOptions.URL).Errorf("error to register the webhook")
+	}
+	return nil
+}
+
+func (t *TeleCraft) deleteWebhook(dropPendingUpdates bool) error {
+	scope := "telecraft.deleteWebhook"
+
+	_, err := t.bot.MakeRequest("deleteWebhook", tgbotapi.Params{
+		"drop_pending_updates": strconv.FormatBool(dropPendingUpdates),
+	})
+	if err != nil {
+		return telecrafterror.Wrap(err).Scope(scope).Errorf("error to delete the webhook")
+	}
+	return nil
+}